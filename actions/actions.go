@@ -4,24 +4,88 @@ import (
 	"context"
 	"fmt"
 	"github.com/live-labs/lokiactor/config"
-	"time"
 )
 
 const RFC3339_MILLI = "2006-01-02T15:04:05.000Z"
 
 type Action interface {
-	// Execute executes an action using the provided timestamp, message, and associated labels.
-	Execute(ts time.Time, message string, labels map[string]string) error
+	// Execute executes an action for the provided event.
+	Execute(e Event) error
 }
 
 // New creates a new action based on the provided configuration.
 func New(ctx context.Context, cfg config.Action) (Action, error) {
+	if cfg.DryRun {
+		return NewDryRunAction(cfg), nil
+	}
+
+	var action Action
 	switch cfg.Type {
 	case "slack":
-		return NewSlackAction(ctx, cfg), nil
+		a, err := NewSlackAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
 	case "cmd":
-		return NewCMDAction(ctx, cfg), nil
+		action = NewCMDAction(ctx, cfg)
+	case "webhook":
+		a, err := NewWebhookAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
+	case "pagerduty":
+		a, err := NewPagerDutyAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
+	case "email":
+		a, err := NewEmailAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
+	case "teams":
+		a, err := NewTeamsAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
+	case "discord":
+		a, err := NewDiscordAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
+	case "mattermost":
+		a, err := NewMattermostAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
+	case "googlechat":
+		a, err := NewGoogleChatAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
+	case "telegram":
+		a, err := NewTelegramAction(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		action = a
 	default:
 		return nil, fmt.Errorf("unknown action type: %s", cfg.Type)
 	}
+
+	if cfg.Retry != nil || cfg.Spool != "" {
+		action = NewRetryAction(ctx, cfg, action)
+	}
+	if cfg.Pool != "" {
+		return NewAsyncAction(ctx, cfg, action), nil
+	}
+	return action, nil
 }
@@ -0,0 +1,116 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"log/slog"
+	"time"
+)
+
+const tick = 5 * time.Second
+
+// batchFailure is a batch send error after the first events of the batch were delivered.
+type batchFailure struct {
+	delivered int // events delivered, the first of the batch
+	err       error
+}
+
+func (f *batchFailure) Error() string {
+	return f.err.Error()
+}
+
+func (f *batchFailure) Unwrap() error {
+	return f.err
+}
+
+// batcher collects the events of an action and sends them together, when the batch is full
+// or a tick after its first event, so a burst of lines produces one message instead of many.
+type batcher struct {
+	name   string
+	kind   string
+	size   int
+	c      chan Event
+	send   func(batch []Event) error
+	idle   func() bool  // optional, called when a tick passed without events, true stops the batcher
+	policy *retryPolicy // retries the batches
+}
+
+func newBatcher(ctx context.Context, cfg config.Action, size int, send func(batch []Event) error, idle func() bool) *batcher {
+	b := &batcher{
+		name:   cfg.Name,
+		kind:   cfg.Type,
+		size:   size,
+		c:      make(chan Event, 10),
+		send:   send,
+		idle:   idle,
+		policy: newRetryPolicy(ctx, cfg),
+	}
+	go b.run(ctx)
+	return b
+}
+
+// add queues an event for the next batch.
+func (b *batcher) add(e Event) error {
+	select {
+	case b.c <- e:
+	case <-time.After(time.Millisecond * 200):
+		return fmt.Errorf("%s action channel is full, message dropped", b.kind)
+	}
+	return nil
+}
+
+func (b *batcher) run(ctx context.Context) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	var batch []Event
+
+	flush := func() {
+		err := b.policy.run(func() error {
+			return b.send(batch)
+		})
+		if err != nil {
+			failed := batch
+			var bf *batchFailure
+			if errors.As(err, &bf) {
+				failed = batch[bf.delivered:]
+			}
+			slog.Error("Error sending batched messages", "action", b.name, "messages", len(batch), "failed", len(failed), "error", err)
+			for _, e := range failed {
+				b.policy.deadLetter(e, err)
+			}
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if len(batch) > 0 {
+				// Final attempt to send remaining messages
+				flush()
+			}
+			return
+
+		case e := <-b.c:
+			if len(batch) == 0 {
+				t.Reset(tick) // reset the timer on first message to avoid immediate send
+			}
+			batch = append(batch, e)
+
+			if len(batch) >= b.size {
+				flush()
+				t.Reset(tick)
+			}
+
+		case <-t.C:
+			if len(batch) > 0 {
+				flush()
+			} else if b.idle != nil && b.idle() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultChatTimeout = 10 * time.Second
+
+// chatOptions are the settings every chat webhook action has, read from the fields of its type.
+type chatOptions struct {
+	webhookURL      string
+	timeoutSec      int64
+	messageTemplate string
+	concat          int
+	prefix          string
+	suffix          string
+}
+
+// chatFormat is the message format of a chat service.
+type chatFormat struct {
+	name      string
+	maxLength int                   // length of a message, longer messages are split
+	size      func(string) int      // length of a text as the service limits it, nil counts characters
+	payload   func(text string) any // the JSON body posted for a message
+}
+
+// ChatAction posts messages to the incoming webhook of a chat service, e.g. Teams or Discord.
+type ChatAction struct {
+	format          chatFormat
+	webhookURL      string
+	client          *http.Client
+	messageTemplate string
+	prefix          string
+	suffix          string
+	batcher         *batcher     // concatenates the messages, nil sends each message immediately
+	policy          *retryPolicy // retries the parts of a message
+}
+
+func newChatAction(ctx context.Context, cfg config.Action, opts chatOptions, format chatFormat) (*ChatAction, error) {
+	if opts.webhookURL == "" {
+		return nil, fmt.Errorf("%s_webhook_url is required for the %s action", cfg.Type, cfg.Type)
+	}
+
+	a := &ChatAction{
+		format:     format,
+		webhookURL: opts.webhookURL,
+		client: &http.Client{
+			Timeout: time.Duration(opts.timeoutSec) * time.Second,
+		},
+		messageTemplate: opts.messageTemplate,
+		prefix:          opts.prefix,
+		suffix:          opts.suffix,
+		policy:          newRetryPolicy(ctx, cfg),
+	}
+
+	if a.format.size == nil {
+		a.format.size = utf8.RuneCountInString
+	}
+	if a.client.Timeout <= 0 {
+		a.client.Timeout = defaultChatTimeout
+	}
+	if a.messageTemplate == "" {
+		a.messageTemplate = "${values.message}"
+	}
+	if opts.concat > 0 {
+		a.batcher = newBatcher(ctx, cfg, opts.concat, a.sendBatch, nil)
+	}
+
+	return a, nil
+}
+
+func (a *ChatAction) Execute(e Event) error {
+	if a.batcher == nil {
+		// send the message immediately
+		return a.sendText(e.Expand(a.messageTemplate), "", "", e.Part)
+	}
+	return a.batcher.add(e)
+}
+
+// sendBatch sends the concatenated messages of a batch. When it fails after the first parts
+// were sent, the messages they held entirely are reported as delivered.
+func (a *ChatAction) sendBatch(batch []Event) error {
+	messages := make([]string, len(batch))
+	var text strings.Builder
+	for i, e := range batch {
+		messages[i] = e.Expand(a.messageTemplate)
+		text.WriteString(messages[i])
+		text.WriteRune('\n')
+	}
+
+	parts := a.split(text.String(), a.prefix, a.suffix)
+	err := a.sendParts(parts, a.prefix, a.suffix, 0)
+
+	var failure *Failure
+	if errors.As(err, &failure) && failure.Part > 0 {
+		return &batchFailure{delivered: deliveredMessages(messages, parts[:failure.Part]), err: err}
+	}
+	return err
+}
+
+// sendText sends a text in as many messages as the length limit of the service needs, each
+// wrapped in the prefix and suffix, so e.g. code blocks stay closed. The parts before from
+// were sent already.
+func (a *ChatAction) sendText(text, prefix, suffix string, from int) error {
+	return a.sendParts(a.split(text, prefix, suffix), prefix, suffix, from)
+}
+
+func (a *ChatAction) split(text, prefix, suffix string) []string {
+	limit := a.format.maxLength - a.format.size(prefix) - a.format.size(suffix)
+	return splitMessage(text, limit, a.format.size)
+}
+
+func (a *ChatAction) sendParts(parts []string, prefix, suffix string, from int) error {
+	return a.policy.sendParts(parts, from, func(part string) error {
+		return a.send(prefix + part + suffix)
+	})
+}
+
+// deliveredMessages returns how many of the concatenated messages the sent parts held entirely.
+// The split drops line breaks at the cuts, so the messages are measured without them.
+func deliveredMessages(messages, sent []string) int {
+	n := 0
+	for _, part := range sent {
+		n += len(part) - strings.Count(part, "\n")
+	}
+	for i, m := range messages {
+		n -= len(m) - strings.Count(m, "\n")
+		if n < 0 {
+			return i
+		}
+	}
+	return len(messages)
+}
+
+func (a *ChatAction) send(text string) error {
+	jsonPayload, err := json.Marshal(a.format.payload(text))
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", a.webhookURL, bytes.NewReader(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return &Failure{Reason: config.RetryNetwork, Err: fmt.Errorf("error sending HTTP request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		failure := statusFailure(resp)
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if len(respBody) > 0 {
+			failure.Err = fmt.Errorf("%w: %s", failure.Err, bytes.TrimSpace(respBody))
+		}
+		return failure
+	}
+
+	slog.Debug("Message successfully sent", "service", a.format.name)
+	return nil
+}
+
+// splitMessage splits a text into parts of at most limit, measured by size, at line breaks
+// when it can.
+func splitMessage(text string, limit int, size func(string) int) []string {
+	text = strings.TrimRight(text, "\n")
+	if limit <= 0 || size(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	var part strings.Builder
+	n := 0 // size of part
+
+	flush := func() {
+		if part.Len() > 0 {
+			parts = append(parts, strings.TrimRight(part.String(), "\n"))
+			part.Reset()
+			n = 0
+		}
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		lineLen := size(line)
+		if n+lineLen > limit && lineLen <= limit {
+			flush() // the line fits in the next part
+		}
+
+		// cut the lines longer than the limit, filling the current part first
+		for n+lineLen > limit {
+			runes := []rune(line)
+			fit, w := 0, 0
+			for ; fit < len(runes); fit++ {
+				w += size(string(runes[fit]))
+				if n+w > limit {
+					break
+				}
+			}
+			cut := cutIndex(runes, fit)
+			if cut == 0 && n == 0 {
+				cut = 1 // a character longer than the limit on its own
+			}
+			part.WriteString(string(runes[:cut]))
+			flush()
+			line = string(runes[cut:])
+			lineLen = size(line)
+		}
+
+		part.WriteString(line)
+		n += lineLen
+	}
+	flush()
+
+	return parts
+}
+
+// cutIndex returns where to cut a line longer than the limit, without separating an escaped
+// character from its backslash or cutting an HTML entity.
+func cutIndex(runes []rune, limit int) int {
+	cut := limit
+
+	backslashes := 0
+	for i := cut - 1; i >= 0 && runes[i] == '\\'; i-- {
+		backslashes++
+	}
+	if backslashes%2 == 1 && cut > 1 {
+		cut--
+	}
+
+	// entities are at most 10 characters long, e.g. &#x1F600;
+	for i := cut - 1; i > 0 && i >= cut-10; i-- {
+		if runes[i] == ';' {
+			break
+		}
+		if runes[i] == '&' {
+			cut = i
+			break
+		}
+	}
+
+	return cut
+}
@@ -9,7 +9,6 @@ import (
 	"log/slog"
 	"os/exec"
 	"strings"
-	"time"
 )
 
 type CMDAction struct {
@@ -25,24 +24,12 @@ func NewCMDAction(ctx context.Context, cfg config.Action) *CMDAction {
 	return a
 }
 
-func (a *CMDAction) Execute(ts time.Time, message string, labels map[string]string) error {
+func (a *CMDAction) Execute(e Event) error {
 
-	// Replace the ${values.ts} and ${values.message} placeholders in the command with the actual values
+	// Replace the ${values.*} and ${labels.*} placeholders in the command with the actual values
 	command := make([]string, len(a.run))
-	copy(command, a.run)
-
-	tsStr := ts.Format(RFC3339_MILLI)
-
-	for i, v := range command {
-
-		v = strings.ReplaceAll(v, "${values.ts}", tsStr)
-		v = strings.ReplaceAll(v, "${values.message}", message)
-
-		for lk, lv := range labels {
-			v = strings.ReplaceAll(v, fmt.Sprintf("${labels.%s}", lk), lv)
-		}
-
-		command[i] = v
+	for i, v := range a.run {
+		command[i] = e.Expand(v)
 	}
 
 	slog.Info("Running action", "action", strings.Join(command, " "))
@@ -83,6 +70,10 @@ func (a *CMDAction) Execute(ts time.Time, message string, labels map[string]stri
 	}
 
 	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return &Failure{Reason: config.RetryExit, Err: fmt.Errorf("failed to run command: %w", err)}
+		}
 		return fmt.Errorf("failed to run command: %w", err)
 	}
 
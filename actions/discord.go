@@ -0,0 +1,33 @@
+package actions
+
+import (
+	"context"
+	"github.com/live-labs/lokiactor/config"
+)
+
+const maxDiscordMessage = 2000 // characters
+
+func NewDiscordAction(ctx context.Context, cfg config.Action) (*ChatAction, error) {
+	return newChatAction(ctx, cfg, chatOptions{
+		webhookURL:      cfg.DiscordWebhookURL,
+		timeoutSec:      cfg.DiscordTimeoutSec,
+		messageTemplate: cfg.DiscordMessageTemplate,
+		concat:          cfg.DiscordConcat,
+		prefix:          cfg.DiscordConcatPrefix,
+		suffix:          cfg.DiscordConcatSuffix,
+	}, chatFormat{
+		name:      "discord",
+		maxLength: maxDiscordMessage,
+		payload: func(text string) any {
+			payload := map[string]any{
+				"content": text,
+				// a log line must not ping @everyone
+				"allowed_mentions": map[string]any{"parse": []string{}},
+			}
+			if cfg.DiscordUsername != "" {
+				payload["username"] = cfg.DiscordUsername
+			}
+			return payload
+		},
+	})
+}
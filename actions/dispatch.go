@@ -0,0 +1,244 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"github.com/live-labs/lokiactor/config"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultQueueSize = 100
+
+// ErrDropped is returned for an event dropped because the queue of its worker was full.
+var ErrDropped = errors.New("action queue is full, event dropped")
+
+// ErrStopped is returned for an event queued after its worker pool stopped.
+var ErrStopped = errors.New("action worker pool stopped")
+
+var pools = struct {
+	sync.Mutex
+	m map[string]*Pool
+}{m: make(map[string]*Pool)}
+
+// AsyncAction queues events for an action run by a worker pool, so a slow action doesn't
+// hold up reading the flow source.
+type AsyncAction struct {
+	name   string
+	action Action
+	pool   *Pool
+}
+
+func NewAsyncAction(ctx context.Context, cfg config.Action, action Action) *AsyncAction {
+	return &AsyncAction{
+		name:   cfg.Name,
+		action: action,
+		pool:   pool(ctx, cfg.Pool, *cfg.Dispatch),
+	}
+}
+
+func (a *AsyncAction) Execute(e Event) error {
+	return a.pool.submit(job{name: a.name, action: a.action, event: e})
+}
+
+// pool returns the named worker pool, creating it on first use.
+func pool(ctx context.Context, name string, cfg config.Dispatch) *Pool {
+	pools.Lock()
+	defer pools.Unlock()
+
+	p, ok := pools.m[name]
+	if !ok {
+		p = newPool(ctx, name, cfg)
+		pools.m[name] = p
+	}
+	return p
+}
+
+// Drain waits for the worker pools to run the events still queued once their context is done.
+func Drain() {
+	pools.Lock()
+	m := pools.m
+	pools.m = make(map[string]*Pool)
+	pools.Unlock()
+
+	for _, p := range m {
+		p.wg.Wait()
+	}
+}
+
+type job struct {
+	name   string
+	action Action
+	event  Event
+}
+
+// Pool runs actions on a fixed number of workers. Events of the same group always go to
+// the same worker, so they run in order.
+type Pool struct {
+	name     string
+	overflow string
+	queues   []*queue
+	dropped  atomic.Int64
+	wg       sync.WaitGroup
+}
+
+func newPool(ctx context.Context, name string, cfg config.Dispatch) *Pool {
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	p := &Pool{
+		name:     name,
+		overflow: cfg.Overflow,
+		queues:   make([]*queue, max(cfg.Workers, 1)),
+	}
+
+	for i := range p.queues {
+		q := newQueue(size)
+		p.queues[i] = q
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(q)
+		}()
+	}
+
+	context.AfterFunc(ctx, func() {
+		for _, q := range p.queues {
+			q.close()
+		}
+	})
+
+	slog.Debug("Action worker pool started", "pool", name, "workers", len(p.queues), "queue_size", size, "overflow", p.overflow)
+	return p
+}
+
+// submit queues a job on the worker of its group, or on the least busy worker for
+// events without a group.
+func (p *Pool) submit(j job) error {
+	var q *queue
+	if j.event.Group != "" {
+		h := fnv.New32a()
+		h.Write([]byte(j.event.Group))
+		q = p.queues[h.Sum32()%uint32(len(p.queues))]
+	} else {
+		for _, candidate := range p.queues {
+			if q == nil || candidate.load() < q.load() {
+				q = candidate
+			}
+		}
+	}
+
+	dropped, err := q.push(j, p.overflow)
+	if dropped != nil {
+		total := p.dropped.Add(1)
+		slog.Warn("Action queue is full, dropping event", "pool", p.name, "action", dropped.name,
+			"overflow", p.overflow, "dropped_total", total)
+	}
+	return err
+}
+
+// work runs the jobs of a queue until it is closed and empty.
+func (p *Pool) work(q *queue) {
+	for {
+		j, ok := q.pop()
+		if !ok {
+			return
+		}
+		if err := j.action.Execute(j.event); err != nil {
+			slog.Error("Failed to run action", "action", j.name, "pool", p.name, "error", err)
+		}
+		q.done()
+	}
+}
+
+// queue is a bounded FIFO of jobs with an overflow policy.
+type queue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond // signals both new jobs and free room
+	jobs   []job
+	size   int
+	busy   bool // a job taken from the queue is running
+	closed bool
+}
+
+func newQueue(size int) *queue {
+	q := &queue{size: size}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// load returns the number of queued and running jobs.
+func (q *queue) load() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.busy {
+		return len(q.jobs) + 1
+	}
+	return len(q.jobs)
+}
+
+// push queues a job, applying the overflow policy when the queue is full. It returns the
+// job dropped to make room, if any.
+func (q *queue) push(j job, overflow string) (*job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.jobs) >= q.size && !q.closed {
+		switch overflow {
+		case config.OverflowDropNewest:
+			return &j, ErrDropped
+		case config.OverflowDropOldest:
+			oldest := q.jobs[0]
+			q.jobs = append(q.jobs[1:], j)
+			q.cond.Broadcast()
+			return &oldest, nil
+		default:
+			q.cond.Wait()
+		}
+	}
+	if q.closed {
+		return nil, ErrStopped
+	}
+
+	q.jobs = append(q.jobs, j)
+	q.cond.Broadcast()
+	return nil, nil
+}
+
+// pop takes the next job, waiting for one. It returns false once the queue is closed and empty.
+func (q *queue) pop() (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.jobs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.jobs) == 0 {
+		return job{}, false
+	}
+
+	j := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	q.busy = true
+	q.cond.Broadcast()
+	return j, true
+}
+
+// done marks the job taken last as finished.
+func (q *queue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.busy = false
+}
+
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,57 @@
+package actions
+
+import (
+	"github.com/live-labs/lokiactor/config"
+	"log/slog"
+	"strings"
+)
+
+// DryRunAction logs what an action would do instead of doing it.
+type DryRunAction struct {
+	name       string
+	actionType string
+	templates  []string
+}
+
+func NewDryRunAction(cfg config.Action) *DryRunAction {
+	a := &DryRunAction{
+		name:       cfg.Name,
+		actionType: cfg.Type,
+	}
+
+	switch cfg.Type {
+	case "slack":
+		a.templates = []string{cfg.SlackMessageTemplate}
+	case "cmd":
+		a.templates = cfg.CmdRun
+	case "webhook":
+		a.templates = []string{cfg.WebhookMethod, cfg.WebhookURL, cfg.WebhookBodyTemplate}
+	case "email":
+		a.templates = append([]string{cfg.EmailSubjectTemplate}, cfg.EmailTo...)
+	case "teams":
+		a.templates = []string{cfg.TeamsMessageTemplate}
+	case "discord":
+		a.templates = []string{cfg.DiscordMessageTemplate}
+	case "mattermost":
+		a.templates = []string{cfg.MattermostMessageTemplate}
+	case "googlechat":
+		a.templates = []string{cfg.GoogleChatMessageTemplate}
+	case "telegram":
+		a.templates = []string{cfg.TelegramChatID, cfg.TelegramMessageTemplate}
+	case "pagerduty":
+		a.templates = []string{cfg.PagerDutyEventAction, cfg.PagerDutyDedupKeyTemplate, cfg.PagerDutySummaryTemplate}
+	}
+
+	return a
+}
+
+func (a *DryRunAction) Execute(e Event) error {
+	expanded := make([]string, len(a.templates))
+	for i, t := range a.templates {
+		expanded[i] = e.Expand(t)
+	}
+
+	slog.Info("Dry run", "action", a.name, "type", a.actionType, "ts", e.Timestamp.Format(RFC3339_MILLI),
+		"labels", e.Labels, "message", e.Message, "output", strings.Join(expanded, " "))
+	return nil
+}
@@ -0,0 +1,410 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEmailTimeout = 10 * time.Second
+	defaultEmailSubject = "Loki-actor: ${values.message}"
+	defaultEmailBody    = "${values.message}"
+)
+
+// EmailAction sends the events by mail. With concat, the events of a burst are sent as one digest
+// per recipient list.
+type EmailAction struct {
+	ctx             context.Context
+	cfg             config.Action
+	addr            string
+	tlsConfig       *tls.Config
+	auth            smtp.Auth
+	timeout         time.Duration
+	subjectTemplate string
+	bodyTemplate    string
+	htmlTemplate    string
+
+	mu       sync.Mutex
+	batchers map[string]*envelopeBatcher // batches of each envelope, if concat is set
+}
+
+// envelopeBatcher batches the mails of an envelope, it stops once idle so templated recipients
+// don't leave a batcher behind for each of them.
+type envelopeBatcher struct {
+	*batcher
+	adding int // events being added, guarded by EmailAction.mu
+}
+
+// envelope is the sender and recipients of a mail, expanded for an event.
+type envelope struct {
+	from *mail.Address
+	to   []*mail.Address
+	cc   []*mail.Address
+}
+
+func NewEmailAction(ctx context.Context, cfg config.Action) (*EmailAction, error) {
+	if cfg.EmailSMTPHost == "" {
+		return nil, errors.New("email_smtp_host is required for the email action")
+	}
+	if cfg.EmailFrom == "" || len(cfg.EmailTo) == 0 {
+		return nil, errors.New("email_from and email_to are required for the email action")
+	}
+
+	a := &EmailAction{
+		ctx: ctx,
+		cfg: cfg,
+		tlsConfig: &tls.Config{
+			ServerName:         cfg.EmailSMTPHost,
+			InsecureSkipVerify: cfg.EmailInsecureSkipVerify,
+		},
+		timeout:         time.Duration(cfg.EmailTimeoutSec) * time.Second,
+		subjectTemplate: cfg.EmailSubjectTemplate,
+		bodyTemplate:    cfg.EmailBodyTemplate,
+		htmlTemplate:    cfg.EmailHTMLTemplate,
+		batchers:        make(map[string]*envelopeBatcher),
+	}
+
+	if a.cfg.EmailTLS == "" {
+		a.cfg.EmailTLS = config.EmailStartTLS
+	}
+
+	port := cfg.EmailSMTPPort
+	switch a.cfg.EmailTLS {
+	case config.EmailStartTLS:
+		if port == 0 {
+			port = 587
+		}
+	case config.EmailImplicitTLS:
+		if port == 0 {
+			port = 465
+		}
+	case config.EmailNoTLS:
+		if port == 0 {
+			port = 25
+		}
+	default:
+		return nil, fmt.Errorf("unknown email tls mode: %s", cfg.EmailTLS)
+	}
+	a.addr = net.JoinHostPort(cfg.EmailSMTPHost, strconv.Itoa(port))
+
+	if cfg.EmailUsername != "" {
+		password := cfg.EmailPassword
+		if cfg.EmailPasswordFile != "" {
+			p, err := config.ReadSecret(cfg.EmailPasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read email password: %w", err)
+			}
+			password = p
+		}
+		a.auth = smtp.PlainAuth("", cfg.EmailUsername, password, cfg.EmailSMTPHost)
+	}
+
+	if a.timeout <= 0 {
+		a.timeout = defaultEmailTimeout
+	}
+	if a.subjectTemplate == "" {
+		a.subjectTemplate = defaultEmailSubject
+	}
+	if a.bodyTemplate == "" && a.htmlTemplate == "" {
+		a.bodyTemplate = defaultEmailBody
+	}
+
+	return a, nil
+}
+
+func (a *EmailAction) Execute(e Event) error {
+	env, err := a.envelope(e)
+	if err != nil {
+		return err
+	}
+
+	if a.cfg.EmailConcat <= 0 {
+		// send the mail immediately
+		return a.send(env, []Event{e})
+	}
+
+	return a.batch(env, e)
+}
+
+// batch adds an event to the batcher of the mails to its envelope, so a digest only holds
+// the events of its recipients.
+func (a *EmailAction) batch(env envelope, e Event) error {
+	key := env.from.Address + "|" + joinAddresses(env.to) + "|" + joinAddresses(env.cc)
+
+	a.mu.Lock()
+	b, ok := a.batchers[key]
+	if !ok {
+		b = &envelopeBatcher{}
+		b.batcher = newBatcher(a.ctx, a.cfg, a.cfg.EmailConcat, func(batch []Event) error {
+			return a.send(env, batch)
+		}, func() bool {
+			return a.evict(key, b)
+		})
+		a.batchers[key] = b
+	}
+	b.adding++
+	a.mu.Unlock()
+
+	err := b.add(e)
+
+	a.mu.Lock()
+	b.adding--
+	a.mu.Unlock()
+
+	return err
+}
+
+// evict removes the batcher of an envelope once it has nothing to send, it must stop then.
+func (a *EmailAction) evict(key string, b *envelopeBatcher) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if b.adding > 0 || len(b.c) > 0 {
+		return false
+	}
+	delete(a.batchers, key)
+	return true
+}
+
+// envelope expands the sender and recipients for an event.
+func (a *EmailAction) envelope(e Event) (envelope, error) {
+	from, err := mail.ParseAddress(e.Expand(a.cfg.EmailFrom))
+	if err != nil {
+		return envelope{}, fmt.Errorf("invalid email sender: %w", err)
+	}
+
+	to, err := expandAddresses(e, a.cfg.EmailTo)
+	if err != nil {
+		return envelope{}, fmt.Errorf("invalid email recipient: %w", err)
+	}
+	if len(to) == 0 {
+		return envelope{}, errors.New("no email recipient")
+	}
+
+	cc, err := expandAddresses(e, a.cfg.EmailCc)
+	if err != nil {
+		return envelope{}, fmt.Errorf("invalid email recipient: %w", err)
+	}
+
+	return envelope{from: from, to: to, cc: cc}, nil
+}
+
+// expandAddresses expands address templates, each may give a comma separated list.
+func expandAddresses(e Event, templates []string) ([]*mail.Address, error) {
+	var addresses []*mail.Address
+	for _, t := range templates {
+		v := strings.TrimSpace(e.Expand(t))
+		if v == "" {
+			continue
+		}
+		list, err := mail.ParseAddressList(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v, err)
+		}
+		addresses = append(addresses, list...)
+	}
+	return addresses, nil
+}
+
+func joinAddresses(addresses []*mail.Address) string {
+	s := make([]string, len(addresses))
+	for i, addr := range addresses {
+		s[i] = addr.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// send sends one mail with the messages of the events.
+func (a *EmailAction) send(env envelope, batch []Event) error {
+	msg, err := a.compose(env, batch)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: a.timeout}
+	var conn net.Conn
+	if a.cfg.EmailTLS == config.EmailImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", a.addr, a.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", a.addr)
+	}
+	if err != nil {
+		return &Failure{Reason: config.RetryNetwork, Err: fmt.Errorf("error connecting to SMTP server: %w", err)}
+	}
+	conn.SetDeadline(time.Now().Add(a.timeout))
+
+	c, err := smtp.NewClient(conn, a.cfg.EmailSMTPHost)
+	if err != nil {
+		conn.Close()
+		return smtpFailure(err)
+	}
+	defer c.Close()
+
+	if a.cfg.EmailTLS == config.EmailStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(a.tlsConfig); err != nil {
+			return smtpFailure(err)
+		}
+	}
+
+	if a.auth != nil {
+		if err := c.Auth(a.auth); err != nil {
+			return smtpFailure(err)
+		}
+	}
+
+	if err := c.Mail(env.from.Address); err != nil {
+		return smtpFailure(err)
+	}
+	for _, rcpt := range slices.Concat(env.to, env.cc) {
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return smtpFailure(err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return smtpFailure(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return smtpFailure(err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpFailure(err)
+	}
+
+	if err := c.Quit(); err != nil {
+		slog.Debug("Failed to close SMTP session", "error", err)
+	}
+
+	slog.Debug("Email successfully sent", "to", joinAddresses(env.to), "messages", len(batch))
+	return nil
+}
+
+// smtpFailure classifies an SMTP error: 4xx replies are temporary, other replies permanent,
+// anything else is a connection failure.
+func smtpFailure(err error) error {
+	err = fmt.Errorf("error sending email: %w", err)
+
+	var reply *textproto.Error
+	switch {
+	case errors.As(err, &reply) && reply.Code >= 400 && reply.Code < 500:
+		return &Failure{Reason: config.RetryServer, Err: err}
+	case errors.As(err, &reply):
+		return &Failure{Err: err}
+	default:
+		return &Failure{Reason: config.RetryNetwork, Err: err}
+	}
+}
+
+// compose builds the mail of a batch: the subject of its first event, the bodies of all events.
+func (a *EmailAction) compose(env envelope, batch []Event) ([]byte, error) {
+	subject := headerValue(batch[0].Expand(a.subjectTemplate))
+	if len(batch) > 1 {
+		subject += fmt.Sprintf(" (+%d more)", len(batch)-1)
+	}
+
+	var text, htmlBody strings.Builder
+	for _, e := range batch {
+		if a.bodyTemplate != "" {
+			text.WriteString(e.Expand(a.bodyTemplate))
+			text.WriteString("\n")
+		}
+		if a.htmlTemplate != "" {
+			htmlBody.WriteString(e.ExpandEscaped(a.htmlTemplate, html.EscapeString))
+			htmlBody.WriteString("\n")
+		}
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + env.from.String() + "\r\n")
+	msg.WriteString("To: " + joinAddresses(env.to) + "\r\n")
+	if len(env.cc) > 0 {
+		msg.WriteString("Cc: " + joinAddresses(env.cc) + "\r\n")
+	}
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Message-ID: " + messageID(env.from) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	switch {
+	case a.bodyTemplate != "" && a.htmlTemplate != "":
+		mw := multipart.NewWriter(&msg)
+		msg.WriteString("Content-Type: multipart/alternative; boundary=" + mw.Boundary() + "\r\n\r\n")
+		if err := writePart(mw, "text/plain", text.String()); err != nil {
+			return nil, err
+		}
+		if err := writePart(mw, "text/html", htmlBody.String()); err != nil {
+			return nil, err
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	case a.htmlTemplate != "":
+		writeBody(&msg, "text/html", htmlBody.String())
+	default:
+		writeBody(&msg, "text/plain", text.String())
+	}
+
+	return msg.Bytes(), nil
+}
+
+// headerValue folds a value to a single line, so a log line can't add headers to the mail.
+func headerValue(v string) string {
+	return strings.Join(strings.Fields(v), " ")
+}
+
+func messageID(from *mail.Address) string {
+	domain := "loki-actor"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(suffix), domain)
+}
+
+func writeBody(w io.Writer, contentType, body string) {
+	fmt.Fprintf(w, "Content-Type: %s; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", contentType)
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+func writePart(mw *multipart.Writer, contentType, body string) error {
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,58 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event is a log line an action is executed for.
+type Event struct {
+	Timestamp    time.Time         `json:"ts"`
+	Message      string            `json:"message"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Values       map[string]string `json:"values,omitempty"`       // additional ${values.*} variables, e.g. tenant
+	Metadata     map[string]string `json:"metadata,omitempty"`     // structured metadata and parsed labels of the line, ${metadata.*}
+	Group        string            `json:"group,omitempty"`        // lines of the same group run in order on worker pools, e.g. a multiline capture
+	Continuation bool              `json:"continuation,omitempty"` // a line of a multiline capture after the matched one
+	Part         int               `json:"part,omitempty"`         // first part of a split message to send, the ones before were delivered
+}
+
+// Expand replaces the ${values.*}, ${labels.*} and ${metadata.*} placeholders in the template with the event values.
+func (e Event) Expand(template string) string {
+	return e.ExpandEscaped(template, nil)
+}
+
+// ExpandEscaped is Expand with the values escaped for the format of the template, e.g. JSON.
+// A nil escape inserts the values as they are.
+func (e Event) ExpandEscaped(template string, escape func(string) string) string {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+
+	v := template
+
+	v = strings.ReplaceAll(v, "${values.ts}", escape(e.Timestamp.Format(RFC3339_MILLI)))
+	v = strings.ReplaceAll(v, "${values.message}", escape(e.Message))
+
+	for vk, vv := range e.Values {
+		v = strings.ReplaceAll(v, fmt.Sprintf("${values.%s}", vk), escape(vv))
+	}
+
+	for lk, lv := range e.Labels {
+		v = strings.ReplaceAll(v, fmt.Sprintf("${labels.%s}", lk), escape(lv))
+	}
+
+	for mk, mv := range e.Metadata {
+		v = strings.ReplaceAll(v, fmt.Sprintf("${metadata.%s}", mk), escape(mv))
+	}
+
+	return v
+}
+
+// jsonEscape escapes a value for a JSON string, without the surrounding quotes.
+func jsonEscape(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
@@ -0,0 +1,25 @@
+package actions
+
+import (
+	"context"
+	"github.com/live-labs/lokiactor/config"
+)
+
+const maxGoogleChatMessage = 4096 // characters
+
+func NewGoogleChatAction(ctx context.Context, cfg config.Action) (*ChatAction, error) {
+	return newChatAction(ctx, cfg, chatOptions{
+		webhookURL:      cfg.GoogleChatWebhookURL,
+		timeoutSec:      cfg.GoogleChatTimeoutSec,
+		messageTemplate: cfg.GoogleChatMessageTemplate,
+		concat:          cfg.GoogleChatConcat,
+		prefix:          cfg.GoogleChatConcatPrefix,
+		suffix:          cfg.GoogleChatConcatSuffix,
+	}, chatFormat{
+		name:      "googlechat",
+		maxLength: maxGoogleChatMessage,
+		payload: func(text string) any {
+			return map[string]string{"text": text}
+		},
+	})
+}
@@ -0,0 +1,35 @@
+package actions
+
+import (
+	"context"
+	"github.com/live-labs/lokiactor/config"
+)
+
+const maxMattermostMessage = 16383 // characters of a post
+
+func NewMattermostAction(ctx context.Context, cfg config.Action) (*ChatAction, error) {
+	return newChatAction(ctx, cfg, chatOptions{
+		webhookURL:      cfg.MattermostWebhookURL,
+		timeoutSec:      cfg.MattermostTimeoutSec,
+		messageTemplate: cfg.MattermostMessageTemplate,
+		concat:          cfg.MattermostConcat,
+		prefix:          cfg.MattermostConcatPrefix,
+		suffix:          cfg.MattermostConcatSuffix,
+	}, chatFormat{
+		name:      "mattermost",
+		maxLength: maxMattermostMessage,
+		payload: func(text string) any {
+			payload := map[string]string{"text": text}
+			if cfg.MattermostUsername != "" {
+				payload["username"] = cfg.MattermostUsername
+			}
+			if cfg.MattermostChannel != "" {
+				payload["channel"] = cfg.MattermostChannel
+			}
+			if cfg.MattermostIconURL != "" {
+				payload["icon_url"] = cfg.MattermostIconURL
+			}
+			return payload
+		},
+	})
+}
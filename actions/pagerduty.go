@@ -0,0 +1,170 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	defaultPagerDutyURL     = "https://events.pagerduty.com/v2/enqueue"
+	defaultPagerDutyTimeout = 10 * time.Second
+
+	maxPagerDutySummary = 1024 // characters, longer summaries are truncated by PagerDuty
+)
+
+var (
+	pagerDutyEventActions = []string{"trigger", "acknowledge", "resolve"}
+	pagerDutySeverities   = []string{"critical", "error", "warning", "info"}
+)
+
+// PagerDutyAction sends the events to the PagerDuty Events API v2. Trigger events with the
+// same dedup key update one incident, a resolve event with that key closes it.
+type PagerDutyAction struct {
+	url               string
+	routingKey        string
+	eventAction       string
+	severity          string
+	summaryTemplate   string
+	sourceTemplate    string
+	componentTemplate string
+	dedupKeyTemplate  string
+	client            *http.Client
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key,omitempty"`
+	Client      string            `json:"client,omitempty"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"` // trigger events only
+}
+
+type pagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Component     string `json:"component,omitempty"`
+	Timestamp     string `json:"timestamp,omitempty"`
+	CustomDetails Event  `json:"custom_details"`
+}
+
+func NewPagerDutyAction(ctx context.Context, cfg config.Action) (*PagerDutyAction, error) {
+	a := &PagerDutyAction{
+		url:               cfg.PagerDutyURL,
+		routingKey:        cfg.PagerDutyRoutingKey,
+		eventAction:       cfg.PagerDutyEventAction,
+		severity:          cfg.PagerDutySeverity,
+		summaryTemplate:   cfg.PagerDutySummaryTemplate,
+		sourceTemplate:    cfg.PagerDutySourceTemplate,
+		componentTemplate: cfg.PagerDutyComponentTemplate,
+		dedupKeyTemplate:  cfg.PagerDutyDedupKeyTemplate,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.PagerDutyTimeoutSec) * time.Second,
+		},
+	}
+
+	if cfg.PagerDutyRoutingKeyFile != "" {
+		key, err := config.ReadSecret(cfg.PagerDutyRoutingKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pagerduty routing key: %w", err)
+		}
+		a.routingKey = key
+	}
+	if a.routingKey == "" {
+		return nil, errors.New("pagerduty_routing_key is required for the pagerduty action")
+	}
+
+	if a.url == "" {
+		a.url = defaultPagerDutyURL
+	}
+	if a.client.Timeout <= 0 {
+		a.client.Timeout = defaultPagerDutyTimeout
+	}
+	if a.eventAction == "" {
+		a.eventAction = "trigger"
+	}
+	if a.severity == "" {
+		a.severity = "error"
+	}
+	if a.summaryTemplate == "" {
+		a.summaryTemplate = "${values.message}"
+	}
+	if a.sourceTemplate == "" {
+		a.sourceTemplate = "loki-actor"
+	}
+
+	if !slices.Contains(pagerDutyEventActions, a.eventAction) {
+		return nil, fmt.Errorf("unknown pagerduty event action: %s", a.eventAction)
+	}
+	if !slices.Contains(pagerDutySeverities, a.severity) {
+		return nil, fmt.Errorf("unknown pagerduty severity: %s", a.severity)
+	}
+	if a.eventAction != "trigger" && a.dedupKeyTemplate == "" {
+		return nil, fmt.Errorf("pagerduty_dedup_key_template is required to %s incidents", a.eventAction)
+	}
+
+	return a, nil
+}
+
+func (a *PagerDutyAction) Execute(e Event) error {
+	event := pagerDutyEvent{
+		RoutingKey:  a.routingKey,
+		EventAction: a.eventAction,
+		DedupKey:    e.Expand(a.dedupKeyTemplate),
+		Client:      "loki-actor",
+	}
+
+	if a.eventAction == "trigger" {
+		summary := []rune(e.Expand(a.summaryTemplate))
+		if len(summary) > maxPagerDutySummary {
+			summary = summary[:maxPagerDutySummary]
+		}
+
+		event.Payload = &pagerDutyPayload{
+			Summary:       string(summary),
+			Source:        e.Expand(a.sourceTemplate),
+			Severity:      a.severity,
+			Component:     e.Expand(a.componentTemplate),
+			Timestamp:     e.Timestamp.UTC().Format(time.RFC3339Nano),
+			CustomDetails: e,
+		}
+	}
+
+	jsonPayload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return &Failure{Reason: config.RetryNetwork, Err: fmt.Errorf("error sending HTTP request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		failure := statusFailure(resp)
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if len(respBody) > 0 {
+			failure.Err = fmt.Errorf("%w: %s", failure.Err, bytes.TrimSpace(respBody))
+		}
+		return failure
+	}
+
+	slog.Debug("Event successfully sent to PagerDuty", "event_action", a.eventAction, "dedup_key", event.DedupKey)
+	return nil
+}
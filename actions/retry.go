@@ -0,0 +1,195 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/backoff"
+	"github.com/live-labs/lokiactor/config"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultMaxAttempts = 3
+
+// Failure is an action error telling whether retrying may help.
+type Failure struct {
+	Reason     string        // one of the config.Retry* failures, empty if retrying would not help
+	RetryAfter time.Duration // delay the receiver asked for, e.g. with the Retry-After header of a 429
+	Part       int           // first part of a split message that was not delivered
+	Err        error
+}
+
+func (f *Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// statusFailure classifies the unexpected status of an HTTP response.
+func statusFailure(resp *http.Response) *Failure {
+	err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &Failure{Reason: config.RetryRateLimit, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")), Err: err}
+	case resp.StatusCode >= 500:
+		return &Failure{Reason: config.RetryServer, Err: err}
+	default:
+		return &Failure{Err: err}
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, given in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// retryPolicy runs an action again after failures that may go away, and spools the events
+// that still failed.
+type retryPolicy struct {
+	ctx      context.Context
+	name     string
+	attempts int
+	backoff  config.Backoff
+	retryOn  map[string]bool // nil retries all failures
+	spool    *Spool          // optional
+}
+
+func newRetryPolicy(ctx context.Context, cfg config.Action) *retryPolicy {
+	p := &retryPolicy{
+		ctx:      ctx,
+		name:     cfg.Name,
+		attempts: 1,
+	}
+
+	if cfg.Retry != nil {
+		p.attempts = cfg.Retry.MaxAttempts
+		if p.attempts <= 0 {
+			p.attempts = defaultMaxAttempts
+		}
+		p.backoff = cfg.Retry.Backoff
+		if len(cfg.Retry.RetryOn) > 0 {
+			p.retryOn = make(map[string]bool, len(cfg.Retry.RetryOn))
+			for _, failure := range cfg.Retry.RetryOn {
+				p.retryOn[failure] = true
+			}
+		}
+	}
+
+	if cfg.Spool != "" {
+		p.spool = NewSpool(cfg.Spool)
+	}
+
+	return p
+}
+
+// retryable returns the delay before retrying after err, false if it should not be retried.
+func (p *retryPolicy) retryable(err error, b *backoff.Backoff) (time.Duration, bool) {
+	var failure *Failure
+	if !errors.As(err, &failure) || failure.Reason == "" {
+		return 0, false
+	}
+	if p.retryOn != nil && !p.retryOn[failure.Reason] {
+		return 0, false
+	}
+	if failure.RetryAfter > 0 {
+		// a receiver asking to wait longer than the backoff allows is retried at its maximum
+		return min(failure.RetryAfter, b.Max()), true
+	}
+	return b.Next(), true
+}
+
+// run calls fn until it succeeds, fails for good or runs out of attempts.
+func (p *retryPolicy) run(fn func() error) error {
+	b := backoff.New(p.backoff)
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.attempts {
+			return err
+		}
+
+		delay, ok := p.retryable(err, b)
+		if !ok {
+			return err
+		}
+
+		slog.Warn("Action failed, retrying", "action", p.name, "attempt", attempt, "retry_in", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-p.ctx.Done():
+			return err
+		}
+	}
+}
+
+// sendParts sends the parts of a message from the part with index from, retrying each on its own
+// so a retry doesn't send the parts already delivered again. A part that still fails is not retried
+// by the caller, its index is the Part of the returned Failure.
+func (p *retryPolicy) sendParts(parts []string, from int, send func(part string) error) error {
+	for i := from; i < len(parts); i++ {
+		err := p.run(func() error {
+			return send(parts[i])
+		})
+		if err != nil {
+			return &Failure{Part: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// deadLetter spools an event that failed for good, so it can be replayed later.
+func (p *retryPolicy) deadLetter(e Event, err error) {
+	if p.spool == nil {
+		return
+	}
+	id, serr := p.spool.Put(p.name, e, err)
+	if serr != nil {
+		slog.Error("Failed to spool event", "action", p.name, "error", serr)
+		return
+	}
+	slog.Warn("Spooled failed event", "action", p.name, "id", id)
+}
+
+// RetryAction retries the executions of an action that failed, and spools the events
+// that still failed.
+type RetryAction struct {
+	action Action
+	policy *retryPolicy
+}
+
+func NewRetryAction(ctx context.Context, cfg config.Action, action Action) *RetryAction {
+	return &RetryAction{
+		action: action,
+		policy: newRetryPolicy(ctx, cfg),
+	}
+}
+
+func (a *RetryAction) Execute(e Event) error {
+	err := a.policy.run(func() error {
+		return a.action.Execute(e)
+	})
+	if err != nil {
+		// a replay resumes at the first part of the message not delivered
+		var failure *Failure
+		if errors.As(err, &failure) {
+			e.Part = max(e.Part, failure.Part)
+		}
+		a.policy.deadLetter(e, err)
+	}
+	return err
+}
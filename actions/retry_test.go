@@ -0,0 +1,116 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/live-labs/lokiactor/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chatStub is a chat webhook recording the messages it accepted, failing for the ones
+// containing fail.
+type chatStub struct {
+	mu       sync.Mutex
+	fail     string
+	accepted []string
+}
+
+func (s *chatStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Content string `json:"content"`
+	}
+	json.NewDecoder(r.Body).Decode(&payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != "" && strings.Contains(payload.Content, s.fail) {
+		http.Error(w, "rejected", http.StatusBadRequest)
+		return
+	}
+	s.accepted = append(s.accepted, payload.Content)
+}
+
+func (s *chatStub) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+func TestSpoolResumesSplitMessage(t *testing.T) {
+	stub := &chatStub{fail: "part-2"}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	cfg := config.Action{
+		Name:              "discord",
+		Type:              "discord",
+		DiscordWebhookURL: srv.URL,
+		Spool:             t.TempDir(),
+	}
+	action, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// three parts of 2000 characters with their line breaks
+	lines := []string{strings.Repeat("a", 1992) + "-part-1", strings.Repeat("b", 1992) + "-part-2", strings.Repeat("c", 1992) + "-part-3"}
+	e := Event{Timestamp: time.Unix(100, 0), Message: strings.Join(lines, "\n")}
+	if err := action.Execute(e); err == nil {
+		t.Fatal("second part did not fail")
+	}
+	if got := stub.messages(); len(got) != 1 || got[0] != lines[0] {
+		t.Fatalf("sent %d messages, want the first part only", len(got))
+	}
+
+	records, err := NewSpool(cfg.Spool).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Event.Part != 1 {
+		t.Fatalf("spooled %+v, want the event resuming at part 1", records)
+	}
+
+	// a replay sends the parts not delivered only
+	stub.mu.Lock()
+	stub.fail = ""
+	stub.mu.Unlock()
+	cfg.Spool = ""
+	replay, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.Execute(records[0].Event); err != nil {
+		t.Fatal(err)
+	}
+	if got := stub.messages(); len(got) != 3 || got[1] != lines[1] || got[2] != lines[2] {
+		t.Errorf("sent %d messages, want the first part once and the others after it", len(got))
+	}
+}
+
+func TestDeliveredMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		sent     []string
+		want     int
+	}{
+		{"nothing sent", []string{"one", "two"}, nil, 0},
+		{"first message", []string{"one", "two"}, []string{"one"}, 1},
+		{"first message and part of the second", []string{"one", "two\nthree"}, []string{"one\ntwo"}, 1},
+		{"all messages", []string{"one", "two"}, []string{"one", "two"}, 2},
+		{"multiline messages", []string{"a\nb", "c\nd", "e"}, []string{"a\nb\nc", "d"}, 2},
+		{"long line cut", []string{"abcdef", "g"}, []string{"abc"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deliveredMessages(tt.messages, tt.sent); got != tt.want {
+				t.Errorf("deliveredMessages = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,120 +4,195 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/live-labs/lokiactor/config"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-const tick = 5 * time.Second
+const (
+	maxSlackCodeBlock   = 4000 // bytes of a code block reply, longer captures continue in a new reply
+	maxSlackBlocks      = 50   // blocks of a message
+	maxSlackAttachments = 100  // attachments of a message
+
+	// characters of the texts of blocks, Slack rejects the whole message when one is longer
+	maxSlackHeaderText  = 150
+	maxSlackSectionText = 3000
+	maxSlackFieldText   = 2000
+)
 
 type SlackAction struct {
+	name            string
 	webhookURL      string
+	api             *slackAPI // posts with the Web API, nil posts to the webhook
+	channel         string
+	thread          string
 	client          *http.Client
 	messageTemplate string
-	c               chan []byte
+	blocks          []any // Block Kit template, optional
+	attachments     []any // attachments template, optional
+	prefix          string
+	suffix          string
+	batcher         *batcher // concatenates the messages, nil sends each message immediately
 }
 
-func NewSlackAction(ctx context.Context, cfg config.Action) *SlackAction {
+func NewSlackAction(ctx context.Context, cfg config.Action) (*SlackAction, error) {
 	sa := &SlackAction{
+		name:       cfg.Name,
 		webhookURL: cfg.SlackWebhookURL,
+		channel:    cfg.SlackChannel,
+		thread:     cfg.SlackThread,
 		client: &http.Client{
 			Timeout: time.Duration(cfg.SlackTimeoutSec) * time.Second,
 		},
 		messageTemplate: cfg.SlackMessageTemplate,
+		prefix:          cfg.SlackConctatPrefix,
+		suffix:          cfg.SlackConcatSuffix,
 	}
 
-	if cfg.SlackConcat <= 0 {
-		return sa
+	var err error
+	if sa.blocks, err = parseSlackTemplate(cfg.SlackBlocks); err != nil {
+		return nil, fmt.Errorf("invalid slack_blocks: %w", err)
+	}
+	if sa.attachments, err = parseSlackTemplate(cfg.SlackAttachments); err != nil {
+		return nil, fmt.Errorf("invalid slack_attachments: %w", err)
+	}
+	if sa.messageTemplate == "" && (sa.blocks != nil || sa.attachments != nil) {
+		sa.messageTemplate = "${values.message}" // the fallback text of notifications
 	}
 
-	sa.c = make(chan []byte, 10)
-
-	go func() {
+	token := cfg.SlackBotToken
+	if cfg.SlackBotTokenFile != "" {
+		t, err := config.ReadSecret(cfg.SlackBotTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slack bot token: %w", err)
+		}
+		token = t
+	}
+	if token != "" {
+		if sa.channel == "" {
+			return nil, errors.New("slack_channel is required with slack_bot_token")
+		}
+		sa.api = &slackAPI{
+			url:    strings.TrimRight(cfg.SlackAPIURL, "/"),
+			token:  token,
+			client: sa.client,
+		}
+		if sa.api.url == "" {
+			sa.api.url = defaultSlackAPIURL
+		}
+	}
 
-		t := time.NewTicker(tick)
+	switch sa.thread {
+	case "":
+	case config.SlackThreadReplies, config.SlackThreadEdit:
+		if sa.api == nil {
+			return nil, errors.New("slack_thread needs slack_bot_token")
+		}
+		if cfg.SlackConcat > 0 {
+			return nil, errors.New("slack_thread can't be used with slack_concat")
+		}
+	default:
+		return nil, fmt.Errorf("unknown slack thread mode: %s", sa.thread)
+	}
 
-		var buffer *bytes.Buffer
-		var n int
+	if cfg.SlackConcat > 0 {
+		sa.batcher = newBatcher(ctx, cfg, cfg.SlackConcat, sa.sendBatch, nil)
+	}
 
-		mkBuffer := func() {
-			buffer = &bytes.Buffer{}
-			buffer.WriteString(cfg.SlackConctatPrefix)
-			n = 0
-		}
+	return sa, nil
+}
 
-		appendBuffer := func(msg []byte) {
-			if n == 0 {
-				t.Reset(tick) // reset the timer on first message to avoid immediate send
-			}
-			if buffer == nil {
-				mkBuffer() // create a new buffer if it doesn't exist
+// message builds the message of an event: its text, the fallback of the notifications when
+// the message has blocks, and its blocks and attachments.
+func (a *SlackAction) message(e Event) map[string]any {
+	msg := map[string]any{
+		"text": e.Expand(a.messageTemplate),
+	}
+	if a.blocks != nil {
+		blocks := expandSlackTemplate(e, a.blocks).([]any)
+		limitSlackBlocks(blocks)
+		msg["blocks"] = blocks
+	}
+	if a.attachments != nil {
+		attachments := expandSlackTemplate(e, a.attachments).([]any)
+		for _, attachment := range attachments {
+			if m, ok := attachment.(map[string]any); ok {
+				blocks, _ := m["blocks"].([]any)
+				limitSlackBlocks(blocks)
 			}
-			buffer.Write(msg)
-			buffer.WriteRune('\n')
-			n++
 		}
+		msg["attachments"] = attachments
+	}
+	return msg
+}
 
-		sendBuffer := func() error {
-			buffer.WriteString(cfg.SlackConcatSuffix)
+// sendBatch sends the concatenated messages of a batch, in several messages if their blocks or
+// attachments don't fit in one.
+func (a *SlackAction) sendBatch(batch []Event) error {
+	var buffer bytes.Buffer
+	var blocks, attachments []any
+	first := 0
+
+	flush := func() error {
+		buffer.WriteString(a.suffix)
+		msg := map[string]any{
+			"text": buffer.String(),
+		}
+		if blocks != nil {
+			msg["blocks"] = blocks
+		}
+		if attachments != nil {
+			msg["attachments"] = attachments
+		}
+		return a.post(batch[first], msg)
+	}
 
-			payload := map[string]string{
-				"text": buffer.String(),
-			}
+	buffer.WriteString(a.prefix)
+	for i, e := range batch {
+		msg := a.message(e)
+		eventBlocks, _ := msg["blocks"].([]any)
+		eventAttachments, _ := msg["attachments"].([]any)
 
-			jsonPayload, err := json.Marshal(payload)
-			if err != nil {
-				return fmt.Errorf("error marshaling payload: %w", err)
-			}
-
-			err = sa.send(bytes.NewReader(jsonPayload))
-			mkBuffer()
-			if err != nil {
+		if i > first && (len(blocks)+len(eventBlocks) > maxSlackBlocks || len(attachments)+len(eventAttachments) > maxSlackAttachments) {
+			if err := flush(); err != nil {
 				return err
 			}
-			return nil
-		}
-
-		for {
-			select {
-			case <-ctx.Done():
-				if n > 0 {
-					// Final attempt to send remaining messages
-					err := sendBuffer()
-					if err != nil {
-						slog.Error("Error sending final messages to Slack", "error", err)
-					}
-				}
-				t.Stop()
-				return
-
-			case msg := <-sa.c:
-				appendBuffer(msg)
-
-				if n >= cfg.SlackConcat {
-					err := sendBuffer()
-					if err != nil {
-						slog.Error("Error sending message to Slack", "error", err)
-					}
-					t.Reset(time.Second * 5) // reset the timer
-				}
-
-			case <-t.C:
-				if n > 0 {
-					err := sendBuffer()
-					if err != nil {
-						slog.Error("Error sending message to Slack", "error", err)
-					}
-				}
-			}
+			buffer.Reset()
+			buffer.WriteString(a.prefix)
+			blocks, attachments = nil, nil
+			first = i
 		}
-	}()
 
-	return sa
+		buffer.WriteString(msg["text"].(string))
+		buffer.WriteRune('\n')
+		blocks = append(blocks, eventBlocks...)
+		attachments = append(attachments, eventAttachments...)
+	}
+
+	return flush()
+}
+
+// post posts a message to the webhook, or with the Web API to the channel of the event.
+func (a *SlackAction) post(e Event, msg map[string]any) error {
+	if a.api != nil {
+		msg["channel"] = e.Expand(a.channel)
+		_, err := a.api.call("chat.postMessage", msg)
+		return err
+	}
+
+	jsonPayload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	return a.send(bytes.NewReader(jsonPayload))
 }
 
 func (a *SlackAction) send(r io.Reader) error {
@@ -131,50 +206,172 @@ func (a *SlackAction) send(r io.Reader) error {
 
 	resp, err := a.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error sending HTTP request: %w", err)
+		return &Failure{Reason: config.RetryNetwork, Err: fmt.Errorf("error sending HTTP request: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return statusFailure(resp)
 	}
 
 	slog.Debug("Message successfully sent to Slack")
 	return nil
 }
 
-func (a *SlackAction) Execute(ts time.Time, message string, labels map[string]string) error {
-	tsStr := ts.Format(RFC3339_MILLI)
+// postThread posts the matched line of a multiline capture as a message, and its next lines
+// in the thread of that message.
+func (a *SlackAction) postThread(e Event) error {
+	key := slackThreadKey(a.name, e.Group)
+	thread := getSlackThread(key)
+	text := e.Expand(a.messageTemplate)
 
-	v := a.messageTemplate
+	if !e.Continuation {
+		if thread != nil {
+			return nil // the matched line runs both the action and the next lines action of the trigger
+		}
 
-	v = strings.ReplaceAll(v, "${values.ts}", tsStr)
-	v = strings.ReplaceAll(v, "${values.message}", message)
+		msg := a.message(e)
+		msg["channel"] = e.Expand(a.channel)
+		resp, err := a.api.call("chat.postMessage", msg)
+		if err != nil {
+			return err
+		}
+		putSlackThread(key, &slackThread{channel: resp.Channel, ts: resp.TS})
+		return nil
+	}
 
-	for lk, lv := range labels {
-		v = strings.ReplaceAll(v, fmt.Sprintf("${labels.%s}", lk), lv)
+	if thread == nil {
+		// the matched line couldn't be posted, post the line on its own
+		return a.post(e, a.message(e))
 	}
 
-	if a.c == nil {
-		// send the message immediately
+	if a.thread == config.SlackThreadReplies {
+		_, err := a.api.call("chat.postMessage", map[string]any{
+			"channel":   thread.channel,
+			"thread_ts": thread.ts,
+			"text":      text,
+		})
+		return err
+	}
 
-		payload := map[string]string{
-			"text": v,
+	lines := append(slices.Clone(thread.lines), text)
+	if thread.replyTS != "" && len(codeBlock(lines)) <= maxSlackCodeBlock {
+		_, err := a.api.call("chat.update", map[string]any{
+			"channel": thread.channel,
+			"ts":      thread.replyTS,
+			"text":    codeBlock(lines),
+		})
+		if err != nil {
+			return err
 		}
+		thread.lines = lines
+		return nil
+	}
 
-		jsonPayload, err := json.Marshal(payload)
-		if err != nil {
-			return fmt.Errorf("error marshaling payload: %w", err)
+	// start a code block reply, the first one or when the previous one is full
+	lines = []string{text}
+	resp, err := a.api.call("chat.postMessage", map[string]any{
+		"channel":   thread.channel,
+		"thread_ts": thread.ts,
+		"text":      codeBlock(lines),
+	})
+	if err != nil {
+		return err
+	}
+	thread.replyTS = resp.TS
+	thread.lines = lines
+	return nil
+}
+
+func (a *SlackAction) Execute(e Event) error {
+	if a.thread != "" && e.Group != "" {
+		return a.postThread(e)
+	}
+
+	if a.batcher == nil {
+		// send the message immediately
+		return a.post(e, a.message(e))
+	}
+
+	return a.batcher.add(e)
+}
+
+// parseSlackTemplate parses a list of blocks or attachments, given as YAML or as a JSON string.
+func parseSlackTemplate(v any) ([]any, error) {
+	if s, ok := v.(string); ok {
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
 		}
+	}
 
-		return a.send(bytes.NewReader(jsonPayload))
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		return t, nil
+	default:
+		return nil, errors.New("must be a list")
 	}
+}
 
-	select {
-	case a.c <- []byte(v):
-	case <-time.After(time.Millisecond * 200):
-		return fmt.Errorf("slack action channel is full, message dropped")
+// expandSlackTemplate replaces the variables in the strings of a template of blocks or attachments.
+func expandSlackTemplate(e Event, v any) any {
+	switch t := v.(type) {
+	case string:
+		return e.Expand(t)
+	case []any:
+		expanded := make([]any, len(t))
+		for i, item := range t {
+			expanded[i] = expandSlackTemplate(e, item)
+		}
+		return expanded
+	case map[string]any:
+		expanded := make(map[string]any, len(t))
+		for k, item := range t {
+			expanded[k] = expandSlackTemplate(e, item)
+		}
+		return expanded
+	case map[any]any:
+		expanded := make(map[string]any, len(t))
+		for k, item := range t {
+			expanded[fmt.Sprint(k)] = expandSlackTemplate(e, item)
+		}
+		return expanded
+	default:
+		return v
 	}
-	return nil
+}
 
+// limitSlackBlocks truncates the texts of header and section blocks to the lengths Slack accepts,
+// so a long log line doesn't get the message rejected.
+func limitSlackBlocks(blocks []any) {
+	for _, block := range blocks {
+		b, ok := block.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch b["type"] {
+		case "header":
+			limitSlackText(b["text"], maxSlackHeaderText)
+		case "section":
+			limitSlackText(b["text"], maxSlackSectionText)
+			fields, _ := b["fields"].([]any)
+			for _, field := range fields {
+				limitSlackText(field, maxSlackFieldText)
+			}
+		}
+	}
+}
+
+// limitSlackText truncates the text of a text object to limit characters.
+func limitSlackText(v any, limit int) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	text, ok := obj["text"].(string)
+	if !ok || utf8.RuneCountInString(text) <= limit {
+		return
+	}
+	obj["text"] = string([]rune(text)[:limit-1]) + "…"
 }
@@ -0,0 +1,129 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSlackAPIURL = "https://slack.com/api"
+
+	slackThreadTTL = time.Hour // threads not continued for longer are forgotten
+)
+
+// slackAPI calls the methods of the Slack Web API with a bot token.
+type slackAPI struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+type slackAPIResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"` // id of the channel the message was posted to
+	TS      string `json:"ts"`      // id of the message in the channel
+}
+
+// call calls an API method, e.g. chat.postMessage.
+func (api *slackAPI) call(method string, payload any) (*slackAPIResponse, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, api.url+"/"+method, bytes.NewReader(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+api.token)
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return nil, &Failure{Reason: config.RetryNetwork, Err: fmt.Errorf("error sending HTTP request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusFailure(resp)
+	}
+
+	var result slackAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, &Failure{Reason: config.RetryServer, Err: fmt.Errorf("error decoding %s response: %w", method, err)}
+	}
+
+	if !result.OK {
+		err := fmt.Errorf("%s failed: %s", method, result.Error)
+		switch result.Error {
+		case "ratelimited":
+			return nil, &Failure{Reason: config.RetryRateLimit, Err: err}
+		case "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+			return nil, &Failure{Reason: config.RetryServer, Err: err}
+		default:
+			return nil, &Failure{Err: err}
+		}
+	}
+
+	return &result, nil
+}
+
+// slackThread is the thread of a multiline capture.
+type slackThread struct {
+	channel string   // channel id of the parent message
+	ts      string   // parent message
+	replyTS string   // reply holding the code block, edit mode
+	lines   []string // lines of the code block
+	used    time.Time
+}
+
+// slackThreads are the threads of the captures in progress, shared by the action instances running
+// the matched line and the continuation lines of a trigger.
+var slackThreads = struct {
+	sync.Mutex
+	m map[string]*slackThread
+}{m: make(map[string]*slackThread)}
+
+// slackThreadKey identifies the thread of an event group of an action.
+func slackThreadKey(action, group string) string {
+	return action + "\x00" + group
+}
+
+func getSlackThread(key string) *slackThread {
+	slackThreads.Lock()
+	defer slackThreads.Unlock()
+
+	t, ok := slackThreads.m[key]
+	if !ok {
+		return nil
+	}
+	t.used = time.Now()
+	return t
+}
+
+func putSlackThread(key string, t *slackThread) {
+	slackThreads.Lock()
+	defer slackThreads.Unlock()
+
+	now := time.Now()
+	for k, old := range slackThreads.m {
+		if now.Sub(old.used) > slackThreadTTL {
+			delete(slackThreads.m, k)
+		}
+	}
+
+	t.used = now
+	slackThreads.m[key] = t
+}
+
+// codeBlock formats lines as a Slack code block.
+func codeBlock(lines []string) string {
+	return "```\n" + strings.Join(lines, "\n") + "\n```"
+}
@@ -0,0 +1,120 @@
+package actions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpoolRecord is an event an action failed to execute.
+type SpoolRecord struct {
+	ID     string    `json:"id"`
+	Action string    `json:"action"`
+	Failed time.Time `json:"failed"`
+	Error  string    `json:"error"`
+	Event  Event     `json:"event"`
+}
+
+// Spool is a dead-letter directory of failed events, one JSON file per event.
+type Spool struct {
+	dir string
+}
+
+func NewSpool(dir string) *Spool {
+	return &Spool{dir: dir}
+}
+
+// Put stores an event the action failed to execute and returns its id.
+func (s *Spool) Put(action string, e Event, cause error) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	now := time.Now()
+	record := SpoolRecord{
+		ID:     strconv.FormatInt(now.UnixNano(), 10) + "-" + hex.EncodeToString(suffix),
+		Action: action,
+		Failed: now,
+		Error:  cause.Error(),
+		Event:  e,
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode spooled event: %w", err)
+	}
+
+	// write to a temporary file and rename it, so a listing never sees a partial record
+	tmp, err := os.CreateTemp(s.dir, ".spool-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(record.ID)); err != nil {
+		return "", fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	return record.ID, nil
+}
+
+// List returns the spooled events, oldest first.
+func (s *Spool) List() ([]SpoolRecord, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var records []SpoolRecord
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spooled event: %w", err)
+		}
+
+		var record SpoolRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("failed to decode spooled event %s: %w", entry.Name(), err)
+		}
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Failed.Before(records[j].Failed)
+	})
+	return records, nil
+}
+
+// Remove deletes a spooled event, e.g. after it was replayed.
+func (s *Spool) Remove(id string) error {
+	return os.Remove(s.path(id))
+}
+
+func (s *Spool) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
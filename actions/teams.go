@@ -0,0 +1,68 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+)
+
+const maxTeamsMessage = 20000 // bytes, Teams rejects payloads over about 28 KB
+
+func NewTeamsAction(ctx context.Context, cfg config.Action) (*ChatAction, error) {
+	format := chatFormat{
+		name:      "teams",
+		maxLength: maxTeamsMessage,
+		size:      func(s string) int { return len(s) }, // the limit is on the payload bytes
+	}
+
+	switch cfg.TeamsCard {
+	case "", "adaptive":
+		format.payload = teamsAdaptiveCard
+	case "message":
+		format.payload = teamsMessageCard
+	default:
+		return nil, fmt.Errorf("unknown teams card: %s", cfg.TeamsCard)
+	}
+
+	return newChatAction(ctx, cfg, chatOptions{
+		webhookURL:      cfg.TeamsWebhookURL,
+		timeoutSec:      cfg.TeamsTimeoutSec,
+		messageTemplate: cfg.TeamsMessageTemplate,
+		concat:          cfg.TeamsConcat,
+		prefix:          cfg.TeamsConcatPrefix,
+		suffix:          cfg.TeamsConcatSuffix,
+	}, format)
+}
+
+// teamsAdaptiveCard is the payload of Workflows webhooks and of the incoming webhooks supporting cards.
+func teamsAdaptiveCard(text string) any {
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{
+			map[string]any{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []any{
+						map[string]any{
+							"type": "TextBlock",
+							"text": text,
+							"wrap": true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// teamsMessageCard is the payload of the legacy Office 365 connectors.
+func teamsMessageCard(text string) any {
+	return map[string]any{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"text":     text,
+	}
+}
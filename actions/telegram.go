@@ -0,0 +1,225 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/backoff"
+	"github.com/live-labs/lokiactor/config"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultTelegramAPIURL  = "https://api.telegram.org"
+	defaultTelegramTimeout = 10 * time.Second
+
+	maxTelegramMessage    = 4096 // characters
+	maxTelegramRateLimits = 3    // times a message waits for the rate limit before failing
+)
+
+// telegramMarkdownV2 are the characters MarkdownV2 needs escaped outside of entities.
+var telegramMarkdownV2 = strings.NewReplacer(
+	`\`, `\\`, `_`, `\_`, `*`, `\*`, `[`, `\[`, `]`, `\]`, `(`, `\(`, `)`, `\)`, `~`, `\~`, "`", "\\`",
+	`>`, `\>`, `#`, `\#`, `+`, `\+`, `-`, `\-`, `=`, `\=`, `|`, `\|`, `{`, `\{`, `}`, `\}`, `.`, `\.`, `!`, `\!`,
+)
+
+// TelegramAction sends the events with the sendMessage method of the Telegram Bot API.
+type TelegramAction struct {
+	ctx             context.Context
+	endpoint        string // sendMessage URL, holds the bot token
+	chatID          string
+	messageTemplate string
+	parseMode       string
+	escape          func(string) string // escapes the variables for the parse mode, nil for plain text
+	client          *http.Client
+	policy          *retryPolicy // retries the parts of a message
+}
+
+type telegramMessage struct {
+	ChatID             string `json:"chat_id"`
+	Text               string `json:"text"`
+	ParseMode          string `json:"parse_mode,omitempty"`
+	LinkPreviewOptions struct {
+		IsDisabled bool `json:"is_disabled"`
+	} `json:"link_preview_options"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func NewTelegramAction(ctx context.Context, cfg config.Action) (*TelegramAction, error) {
+	token := cfg.TelegramBotToken
+	if cfg.TelegramBotTokenFile != "" {
+		t, err := config.ReadSecret(cfg.TelegramBotTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read telegram bot token: %w", err)
+		}
+		token = t
+	}
+	if token == "" || cfg.TelegramChatID == "" {
+		return nil, errors.New("telegram_bot_token and telegram_chat_id are required for the telegram action")
+	}
+
+	apiURL := cfg.TelegramAPIURL
+	if apiURL == "" {
+		apiURL = defaultTelegramAPIURL
+	}
+
+	a := &TelegramAction{
+		ctx:             ctx,
+		endpoint:        strings.TrimRight(apiURL, "/") + "/bot" + token + "/sendMessage",
+		chatID:          cfg.TelegramChatID,
+		messageTemplate: cfg.TelegramMessageTemplate,
+		parseMode:       cfg.TelegramParseMode,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.TelegramTimeoutSec) * time.Second,
+		},
+		policy: newRetryPolicy(ctx, cfg),
+	}
+
+	switch a.parseMode {
+	case "":
+	case "MarkdownV2":
+		a.escape = telegramMarkdownV2.Replace
+	case "HTML":
+		a.escape = html.EscapeString
+	default:
+		return nil, fmt.Errorf("unsupported telegram parse mode: %s", a.parseMode)
+	}
+
+	if a.client.Timeout <= 0 {
+		a.client.Timeout = defaultTelegramTimeout
+	}
+	if a.messageTemplate == "" {
+		a.messageTemplate = "${values.message}"
+	}
+
+	return a, nil
+}
+
+func (a *TelegramAction) Execute(e Event) error {
+	chatID := e.Expand(a.chatID)
+
+	parts := a.split(e)
+	return a.policy.sendParts(parts, e.Part, func(part string) error {
+		return a.sendPart(chatID, part)
+	})
+}
+
+// split expands the template for the event, in several parts when it is too long. The message
+// is split before it is escaped and put into the template, so every part keeps the formatting
+// of the template, e.g. a <pre> block or a code fence, and no escaped character is cut.
+func (a *TelegramAction) split(e Event) []string {
+	text := e.ExpandEscaped(a.messageTemplate, a.escape)
+	n := strings.Count(a.messageTemplate, "${values.message}")
+	if n == 0 || utf8.RuneCountInString(text) <= maxTelegramMessage {
+		return splitMessage(text, maxTelegramMessage, utf8.RuneCountInString)
+	}
+
+	empty := e
+	empty.Message = ""
+	limit := (maxTelegramMessage - utf8.RuneCountInString(empty.ExpandEscaped(a.messageTemplate, a.escape))) / n
+	if limit <= 0 {
+		// the template is too long by itself, only the text can be split
+		return splitMessage(text, maxTelegramMessage, utf8.RuneCountInString)
+	}
+
+	size := utf8.RuneCountInString
+	if a.escape != nil {
+		size = func(s string) int {
+			return utf8.RuneCountInString(a.escape(s))
+		}
+	}
+
+	chunks := splitMessage(e.Message, limit, size)
+	parts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		part := e
+		part.Message = chunk
+		parts[i] = part.ExpandEscaped(a.messageTemplate, a.escape)
+	}
+	return parts
+}
+
+// sendPart sends a part of a message, waiting for the rate limit of the chat if it must.
+func (a *TelegramAction) sendPart(chatID, text string) error {
+	for n := 1; ; n++ {
+		err := a.send(chatID, text)
+
+		var failure *Failure
+		if n >= maxTelegramRateLimits || !errors.As(err, &failure) || failure.Reason != config.RetryRateLimit {
+			return err
+		}
+
+		delay := min(max(failure.RetryAfter, time.Second), backoff.New(a.policy.backoff).Max())
+		slog.Warn("Telegram rate limit reached, waiting", "chat_id", chatID, "retry_in", delay)
+		select {
+		case <-time.After(delay):
+		case <-a.ctx.Done():
+			return err
+		}
+	}
+}
+
+func (a *TelegramAction) send(chatID, text string) error {
+	msg := telegramMessage{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: a.parseMode,
+	}
+	msg.LinkPreviewOptions.IsDisabled = true
+
+	jsonPayload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint, bytes.NewReader(jsonPayload))
+	if err != nil {
+		return errors.New("error creating HTTP request, check telegram_api_url")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		// the error of the client holds the URL, and so the bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return &Failure{Reason: config.RetryNetwork, Err: fmt.Errorf("error sending HTTP request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		slog.Debug("Message successfully sent to Telegram", "chat_id", chatID)
+		return nil
+	}
+
+	failure := statusFailure(resp)
+
+	var result telegramResponse
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(body, &result) == nil && result.Description != "" {
+		failure.Err = fmt.Errorf("%w: %s", failure.Err, result.Description)
+	}
+	if result.Parameters.RetryAfter > 0 {
+		failure.RetryAfter = time.Duration(result.Parameters.RetryAfter) * time.Second
+	}
+
+	return failure
+}
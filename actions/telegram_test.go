@@ -0,0 +1,150 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/live-labs/lokiactor/config"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// telegramStub is a Bot API recording the texts of the messages sent.
+type telegramStub struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (s *telegramStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/bottoken/sendMessage" {
+		http.NotFound(w, r)
+		return
+	}
+	var msg telegramMessage
+	json.NewDecoder(r.Body).Decode(&msg)
+
+	s.mu.Lock()
+	s.texts = append(s.texts, msg.Text)
+	s.mu.Unlock()
+	w.Write([]byte(`{"ok": true}`))
+}
+
+func TestTelegramSplitKeepsTemplate(t *testing.T) {
+	// log lines with characters the parse modes escape, three of them need more than one message
+	line := strings.Repeat("<a href=x>_*[1.5]</a> & ", 80)
+	message := strings.Join([]string{line, line, line, line}, "\n")
+
+	tests := []struct {
+		name      string
+		parseMode string
+		template  string
+		prefix    string
+		suffix    string
+		unescape  func(string) string
+	}{
+		{
+			name:      "html pre block",
+			parseMode: "HTML",
+			template:  "<b>${labels.app}</b>\n<pre>${values.message}</pre>",
+			prefix:    "<b>api</b>\n<pre>",
+			suffix:    "</pre>",
+			unescape:  html.UnescapeString,
+		},
+		{
+			name:      "markdown code fence",
+			parseMode: "MarkdownV2",
+			template:  "*${labels.app}*\n```\n${values.message}\n```",
+			prefix:    "*api*\n```\n",
+			suffix:    "\n```",
+			unescape: func(s string) string {
+				var b strings.Builder
+				for i := 0; i < len(s); i++ {
+					if s[i] == '\\' {
+						i++
+					}
+					b.WriteByte(s[i])
+				}
+				return b.String()
+			},
+		},
+		{
+			name:     "plain text",
+			template: "${labels.app}: ${values.message}",
+			prefix:   "api: ",
+			unescape: func(s string) string { return s },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &telegramStub{}
+			srv := httptest.NewServer(stub)
+			defer srv.Close()
+
+			action, err := NewTelegramAction(context.Background(), config.Action{
+				Type:                    "telegram",
+				TelegramAPIURL:          srv.URL,
+				TelegramBotToken:        "token",
+				TelegramChatID:          "42",
+				TelegramParseMode:       tt.parseMode,
+				TelegramMessageTemplate: tt.template,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := Event{Timestamp: time.Unix(100, 0), Message: message, Labels: map[string]string{"app": "api"}}
+			if err := action.Execute(e); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(stub.texts) < 2 {
+				t.Fatalf("sent %d messages, want the message split", len(stub.texts))
+			}
+			var sent []string
+			for i, text := range stub.texts {
+				if n := utf8.RuneCountInString(text); n > maxTelegramMessage {
+					t.Errorf("part %d has %d characters", i, n)
+				}
+				if !strings.HasPrefix(text, tt.prefix) || !strings.HasSuffix(text, tt.suffix) {
+					t.Errorf("part %d is not wrapped in the template: %.40q...%q", i, text, text[max(0, len(text)-20):])
+					continue
+				}
+				sent = append(sent, tt.unescape(strings.TrimSuffix(strings.TrimPrefix(text, tt.prefix), tt.suffix)))
+			}
+			if got := strings.Join(sent, ""); strings.ReplaceAll(got, "\n", "") != strings.ReplaceAll(message, "\n", "") {
+				t.Error("the parts don't add up to the message")
+			}
+		})
+	}
+}
+
+func TestTelegramShortMessage(t *testing.T) {
+	stub := &telegramStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	action, err := NewTelegramAction(context.Background(), config.Action{
+		Type:                    "telegram",
+		TelegramAPIURL:          srv.URL,
+		TelegramBotToken:        "token",
+		TelegramChatID:          "42",
+		TelegramParseMode:       "HTML",
+		TelegramMessageTemplate: "<pre>${values.message}</pre>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := action.Execute(Event{Message: "a < b"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.texts) != 1 || stub.texts[0] != "<pre>a &lt; b</pre>" {
+		t.Errorf("sent %q", stub.texts)
+	}
+}
@@ -0,0 +1,142 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// WebhookAction sends an HTTP request for each event, e.g. to an incident API.
+type WebhookAction struct {
+	method         string
+	url            string
+	headers        map[string]string
+	bodyTemplate   string
+	escape         func(string) string // escapes the variables of the body, nil for non JSON bodies
+	expectedStatus []int
+	authorization  string
+	client         *http.Client
+}
+
+func NewWebhookAction(ctx context.Context, cfg config.Action) (*WebhookAction, error) {
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("webhook_url is required for the webhook action")
+	}
+
+	a := &WebhookAction{
+		method:         cfg.WebhookMethod,
+		url:            cfg.WebhookURL,
+		headers:        make(map[string]string, len(cfg.WebhookHeaders)+1),
+		bodyTemplate:   cfg.WebhookBodyTemplate,
+		expectedStatus: cfg.WebhookExpectedStatus,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.WebhookTimeoutSec) * time.Second,
+		},
+	}
+
+	if a.method == "" {
+		a.method = http.MethodPost
+	}
+	if a.client.Timeout <= 0 {
+		a.client.Timeout = defaultWebhookTimeout
+	}
+
+	for k, v := range cfg.WebhookHeaders {
+		a.headers[http.CanonicalHeaderKey(k)] = v
+	}
+	if a.bodyTemplate != "" {
+		if _, ok := a.headers["Content-Type"]; !ok {
+			a.headers["Content-Type"] = "application/json"
+		}
+		contentType, _, _ := mime.ParseMediaType(a.headers["Content-Type"])
+		if contentType == "application/json" || strings.HasSuffix(contentType, "+json") {
+			a.escape = jsonEscape
+		}
+	}
+
+	if cfg.WebhookBasicAuth != nil {
+		password := cfg.WebhookBasicAuth.Password
+		if cfg.WebhookBasicAuth.PasswordFile != "" {
+			p, err := config.ReadSecret(cfg.WebhookBasicAuth.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read webhook password: %w", err)
+			}
+			password = p
+		}
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(cfg.WebhookBasicAuth.Username, password)
+		a.authorization = req.Header.Get("Authorization")
+	}
+
+	token := cfg.WebhookBearerToken
+	if cfg.WebhookBearerTokenFile != "" {
+		t, err := config.ReadSecret(cfg.WebhookBearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook bearer token: %w", err)
+		}
+		token = t
+	}
+	if token != "" {
+		if cfg.WebhookBasicAuth != nil {
+			return nil, errors.New("webhook basic auth and bearer token are mutually exclusive")
+		}
+		a.authorization = "Bearer " + token
+	}
+
+	return a, nil
+}
+
+func (a *WebhookAction) Execute(e Event) error {
+	var body io.Reader
+	if a.bodyTemplate != "" {
+		body = strings.NewReader(e.ExpandEscaped(a.bodyTemplate, a.escape))
+	}
+
+	req, err := http.NewRequest(a.method, e.Expand(a.url), body)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+
+	for k, v := range a.headers {
+		req.Header.Set(k, e.Expand(v))
+	}
+	if a.authorization != "" {
+		req.Header.Set("Authorization", a.authorization)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return &Failure{Reason: config.RetryNetwork, Err: fmt.Errorf("error sending HTTP request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if !a.expected(resp.StatusCode) {
+		failure := statusFailure(resp)
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if len(respBody) > 0 {
+			failure.Err = fmt.Errorf("%w: %s", failure.Err, strings.TrimSpace(string(respBody)))
+		}
+		return failure
+	}
+
+	slog.Debug("Webhook successfully sent", "method", a.method, "status", resp.StatusCode)
+	return nil
+}
+
+// expected tells whether the response status means success.
+func (a *WebhookAction) expected(status int) bool {
+	if len(a.expectedStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	return slices.Contains(a.expectedStatus, status)
+}
@@ -0,0 +1,81 @@
+package backoff
+
+import (
+	"github.com/live-labs/lokiactor/config"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultInitialDelay = time.Second
+	defaultMaxDelay     = 2 * time.Minute
+	defaultMultiplier   = 2.0
+	defaultJitter       = 0.2
+)
+
+// Backoff computes exponentially growing retry delays with random jitter.
+type Backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64 // fraction of the delay to randomize, 0..1
+
+	attempt int
+}
+
+func New(cfg config.Backoff) *Backoff {
+	b := &Backoff{
+		initial:    time.Duration(cfg.InitialDelayMs) * time.Millisecond,
+		max:        time.Duration(cfg.MaxDelayMs) * time.Millisecond,
+		multiplier: cfg.Multiplier,
+		jitter:     cfg.Jitter,
+	}
+
+	if b.initial <= 0 {
+		b.initial = defaultInitialDelay
+	}
+	if b.max <= 0 {
+		b.max = defaultMaxDelay
+	}
+	if b.max < b.initial {
+		b.max = b.initial
+	}
+	if b.multiplier < 1 {
+		b.multiplier = defaultMultiplier
+	}
+	if b.jitter <= 0 || b.jitter > 1 {
+		b.jitter = defaultJitter
+	}
+
+	return b
+}
+
+// Next returns the delay before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	d := float64(b.initial)
+	for i := 0; i < b.attempt && d < float64(b.max); i++ {
+		d *= b.multiplier
+	}
+	b.attempt++
+
+	// spread the retries of many clients, so they don't hit the server at the same moment
+	d += d * b.jitter * (2*rand.Float64() - 1)
+
+	return time.Duration(min(d, float64(b.max)))
+}
+
+// Capped returns the maximum delay, used when retrying quickly would not help.
+func (b *Backoff) Capped() time.Duration {
+	b.attempt++
+	return b.max
+}
+
+// Max returns the longest delay of the backoff.
+func (b *Backoff) Max() time.Duration {
+	return b.max
+}
+
+// Reset starts over from the initial delay after a success.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
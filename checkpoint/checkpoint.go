@@ -0,0 +1,121 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpoint is the position of a flow in its log stream.
+type Checkpoint struct {
+	Ts   int64    `json:"ts"`             // nanosecond unix epoch of the last processed line
+	Seen []string `json:"seen,omitempty"` // keys of the lines already processed at Ts
+}
+
+// Store persists flow checkpoints between restarts, keyed by flow name.
+type Store interface {
+	// Load returns the checkpoint of the flow, ok is false if the flow has none.
+	Load(flow string) (cp Checkpoint, ok bool, err error)
+	// Save stores the checkpoint of the flow.
+	Save(flow string, cp Checkpoint) error
+}
+
+// New creates a checkpoint store based on the provided configuration.
+// It returns nil if checkpoints are not configured.
+func New(cfg config.Checkpoint) (Store, error) {
+	switch cfg.Type {
+	case "":
+		if cfg.Path == "" {
+			return nil, nil
+		}
+		return NewFileStore(cfg.Path)
+	case "file":
+		return NewFileStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown checkpoint store type: %s", cfg.Type)
+	}
+}
+
+// FileStore keeps checkpoints of all flows in a single JSON file.
+type FileStore struct {
+	path string
+
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, errors.New("checkpoint file path is required")
+	}
+
+	s := &FileStore{
+		path:        path,
+		checkpoints: make(map[string]Checkpoint),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.checkpoints); err != nil {
+			return nil, fmt.Errorf("failed to parse checkpoint file %s: %w", path, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Load(flow string) (Checkpoint, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.checkpoints[flow]
+	return cp, ok, nil
+}
+
+func (s *FileStore) Save(flow string, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[flow] = cp
+
+	data, err := json.MarshalIndent(s.checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %w", err)
+	}
+
+	// write to a temporary file first, so a crash never leaves a truncated checkpoint file
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace checkpoint file: %w", err)
+	}
+
+	return nil
+}
@@ -4,11 +4,19 @@ import (
 	"bytes"
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
 )
 
 type Action struct {
-	Type string `yaml:"type"` // slack, cmd
+	Name   string `yaml:"-"` // action name, set on load
+	DryRun bool   `yaml:"-"` // log what the action would do instead of doing it
+	Pool   string `yaml:"-"` // worker pool the action runs on, set on load; empty runs it on the flow
+	Spool  string `yaml:"-"` // directory of the events the action failed to execute, set on load
+
+	Type string `yaml:"type"` // slack, cmd, webhook, pagerduty, email, teams, discord, mattermost, googlechat, telegram
 
 	Abstract bool   `yaml:"abstract,omitempty"` // if true, this action is not used directly, but is extended by other actions
 	Extends  string `yaml:"extends,omitempty"`  // extends another action
@@ -20,9 +28,147 @@ type Action struct {
 	SlackConcat          int    `yaml:"slack_concat,omitempty"`
 	SlackConctatPrefix   string `yaml:"slack_concat_prefix,omitempty"`
 	SlackConcatSuffix    string `yaml:"slack_concat_suffix,omitempty"`
+	SlackBotToken        string `yaml:"slack_bot_token,omitempty"`      // posts with the Web API instead of the webhook
+	SlackBotTokenFile    string `yaml:"slack_bot_token_file,omitempty"` // read the bot token from a file instead
+	SlackChannel         string `yaml:"slack_channel,omitempty"`        // channel of the Web API messages, may use variables
+	SlackThread          string `yaml:"slack_thread,omitempty"`         // replies or edit: post the lines of a multiline capture in a thread
+	SlackAPIURL          string `yaml:"slack_api_url,omitempty"`        // default https://slack.com/api
+	SlackBlocks          any    `yaml:"slack_blocks,omitempty"`         // Block Kit blocks, as YAML or a JSON string; the message template is the fallback text
+	SlackAttachments     any    `yaml:"slack_attachments,omitempty"`    // attachments, as YAML or a JSON string, e.g. with the color of the trigger
 
 	// cmd action
 	CmdRun []string `yaml:"cmd_run,omitempty"`
+
+	// webhook action
+	WebhookMethod          string            `yaml:"webhook_method,omitempty"`            // default POST
+	WebhookURL             string            `yaml:"webhook_url,omitempty"`               // may use variables
+	WebhookHeaders         map[string]string `yaml:"webhook_headers,omitempty"`           // values may use variables
+	WebhookBodyTemplate    string            `yaml:"webhook_body_template,omitempty"`     // variables are JSON escaped for JSON content types
+	WebhookTimeoutSec      int64             `yaml:"webhook_timeout_sec,omitempty"`       // default 10
+	WebhookExpectedStatus  []int             `yaml:"webhook_expected_status,omitempty"`   // any 2xx by default
+	WebhookBasicAuth       *BasicAuth        `yaml:"webhook_basic_auth,omitempty"`        // optional
+	WebhookBearerToken     string            `yaml:"webhook_bearer_token,omitempty"`      // optional, not together with basic auth
+	WebhookBearerTokenFile string            `yaml:"webhook_bearer_token_file,omitempty"` // read the bearer token from a file instead
+
+	// pagerduty action
+	PagerDutyRoutingKey        string `yaml:"pagerduty_routing_key,omitempty"`        // integration key of the Events API v2 integration
+	PagerDutyRoutingKeyFile    string `yaml:"pagerduty_routing_key_file,omitempty"`   // read the routing key from a file instead
+	PagerDutyEventAction       string `yaml:"pagerduty_event_action,omitempty"`       // trigger (default), acknowledge or resolve
+	PagerDutySeverity          string `yaml:"pagerduty_severity,omitempty"`           // critical, error (default), warning or info
+	PagerDutySummaryTemplate   string `yaml:"pagerduty_summary_template,omitempty"`   // default ${values.message}
+	PagerDutySourceTemplate    string `yaml:"pagerduty_source_template,omitempty"`    // default loki-actor
+	PagerDutyComponentTemplate string `yaml:"pagerduty_component_template,omitempty"` // optional
+	PagerDutyDedupKeyTemplate  string `yaml:"pagerduty_dedup_key_template,omitempty"` // groups the events into one incident, required to resolve
+	PagerDutyURL               string `yaml:"pagerduty_url,omitempty"`                // default https://events.pagerduty.com/v2/enqueue
+	PagerDutyTimeoutSec        int64  `yaml:"pagerduty_timeout_sec,omitempty"`        // default 10
+
+	// email action
+	EmailSMTPHost           string   `yaml:"email_smtp_host,omitempty"`
+	EmailSMTPPort           int      `yaml:"email_smtp_port,omitempty"`            // default 587, 465 for implicit TLS, 25 without TLS
+	EmailTLS                string   `yaml:"email_tls,omitempty"`                  // starttls (default), tls (implicit) or none
+	EmailInsecureSkipVerify bool     `yaml:"email_insecure_skip_verify,omitempty"` // skip the verification of the server certificate
+	EmailUsername           string   `yaml:"email_username,omitempty"`             // optional, authenticates with PLAIN
+	EmailPassword           string   `yaml:"email_password,omitempty"`             // optional
+	EmailPasswordFile       string   `yaml:"email_password_file,omitempty"`        // read the password from a file instead
+	EmailFrom               string   `yaml:"email_from,omitempty"`                 // may use variables
+	EmailTo                 []string `yaml:"email_to,omitempty"`                   // may use variables
+	EmailCc                 []string `yaml:"email_cc,omitempty"`                   // may use variables
+	EmailSubjectTemplate    string   `yaml:"email_subject_template,omitempty"`     // subject of the first message of a batch
+	EmailBodyTemplate       string   `yaml:"email_body_template,omitempty"`        // plain text body
+	EmailHTMLTemplate       string   `yaml:"email_html_template,omitempty"`        // HTML body, variables are HTML escaped
+	EmailTimeoutSec         int64    `yaml:"email_timeout_sec,omitempty"`          // default 10
+	EmailConcat             int      `yaml:"email_concat,omitempty"`               // number of messages to send in one mail
+
+	// teams action
+	TeamsWebhookURL      string `yaml:"teams_webhook_url,omitempty"`
+	TeamsTimeoutSec      int64  `yaml:"teams_timeout_sec,omitempty"`
+	TeamsMessageTemplate string `yaml:"teams_message_template,omitempty"`
+	TeamsCard            string `yaml:"teams_card,omitempty"` // adaptive (default) or message, the legacy MessageCard
+	TeamsConcat          int    `yaml:"teams_concat,omitempty"`
+	TeamsConcatPrefix    string `yaml:"teams_concat_prefix,omitempty"`
+	TeamsConcatSuffix    string `yaml:"teams_concat_suffix,omitempty"`
+
+	// discord action
+	DiscordWebhookURL      string `yaml:"discord_webhook_url,omitempty"`
+	DiscordTimeoutSec      int64  `yaml:"discord_timeout_sec,omitempty"`
+	DiscordMessageTemplate string `yaml:"discord_message_template,omitempty"`
+	DiscordUsername        string `yaml:"discord_username,omitempty"` // overrides the name of the webhook
+	DiscordConcat          int    `yaml:"discord_concat,omitempty"`
+	DiscordConcatPrefix    string `yaml:"discord_concat_prefix,omitempty"`
+	DiscordConcatSuffix    string `yaml:"discord_concat_suffix,omitempty"`
+
+	// mattermost action
+	MattermostWebhookURL      string `yaml:"mattermost_webhook_url,omitempty"`
+	MattermostTimeoutSec      int64  `yaml:"mattermost_timeout_sec,omitempty"`
+	MattermostMessageTemplate string `yaml:"mattermost_message_template,omitempty"`
+	MattermostUsername        string `yaml:"mattermost_username,omitempty"` // optional, if the webhook may override it
+	MattermostChannel         string `yaml:"mattermost_channel,omitempty"`  // optional, if the webhook may override it
+	MattermostIconURL         string `yaml:"mattermost_icon_url,omitempty"` // optional, if the webhook may override it
+	MattermostConcat          int    `yaml:"mattermost_concat,omitempty"`
+	MattermostConcatPrefix    string `yaml:"mattermost_concat_prefix,omitempty"`
+	MattermostConcatSuffix    string `yaml:"mattermost_concat_suffix,omitempty"`
+
+	// googlechat action
+	GoogleChatWebhookURL      string `yaml:"googlechat_webhook_url,omitempty"`
+	GoogleChatTimeoutSec      int64  `yaml:"googlechat_timeout_sec,omitempty"`
+	GoogleChatMessageTemplate string `yaml:"googlechat_message_template,omitempty"`
+	GoogleChatConcat          int    `yaml:"googlechat_concat,omitempty"`
+	GoogleChatConcatPrefix    string `yaml:"googlechat_concat_prefix,omitempty"`
+	GoogleChatConcatSuffix    string `yaml:"googlechat_concat_suffix,omitempty"`
+
+	// telegram action
+	TelegramBotToken        string `yaml:"telegram_bot_token,omitempty"`
+	TelegramBotTokenFile    string `yaml:"telegram_bot_token_file,omitempty"` // read the bot token from a file instead
+	TelegramChatID          string `yaml:"telegram_chat_id,omitempty"`        // may use variables
+	TelegramMessageTemplate string `yaml:"telegram_message_template,omitempty"`
+	TelegramParseMode       string `yaml:"telegram_parse_mode,omitempty"`  // MarkdownV2 or HTML, variables are escaped for it; plain text by default
+	TelegramAPIURL          string `yaml:"telegram_api_url,omitempty"`     // default https://api.telegram.org
+	TelegramTimeoutSec      int64  `yaml:"telegram_timeout_sec,omitempty"` // default 10
+
+	Dispatch *Dispatch `yaml:"dispatch,omitempty"` // run the action on its own worker pool, instead of the global one
+	Retry    *Retry    `yaml:"retry,omitempty"`    // retry failed executions
+}
+
+// Threads of the slack action.
+const (
+	SlackThreadReplies = "replies" // each line of the capture is a reply to its first line
+	SlackThreadEdit    = "edit"    // the lines of the capture are edited into one code block reply
+)
+
+// Transport security of the email action.
+const (
+	EmailStartTLS    = "starttls" // upgrade the plain connection, usually on port 587
+	EmailImplicitTLS = "tls"      // usually on port 465
+	EmailNoTLS       = "none"     // usually on port 25
+)
+
+// Failures an action can retry.
+const (
+	RetryNetwork   = "network"    // the request failed or timed out
+	RetryRateLimit = "rate_limit" // HTTP 429, retried after the Retry-After delay
+	RetryServer    = "server"     // HTTP 5xx
+	RetryExit      = "exit"       // the command exited with a non-zero status
+)
+
+type Retry struct {
+	MaxAttempts int      `yaml:"max_attempts,omitempty"` // attempts including the first one, default 3
+	Backoff     Backoff  `yaml:"backoff,omitempty"`      // delays between the attempts
+	RetryOn     []string `yaml:"retry_on,omitempty"`     // failures to retry: network, rate_limit, server, exit; all by default
+}
+
+const (
+	OverflowBlock      = "block"       // wait for room in the queue, holding up the flow
+	OverflowDropOldest = "drop_oldest" // drop the longest waiting event
+	OverflowDropNewest = "drop_newest" // drop the event being queued
+)
+
+// GlobalPool is the name of the worker pool of actions without their own dispatch settings.
+const GlobalPool = "*"
+
+type Dispatch struct {
+	Workers   int    `yaml:"workers,omitempty"`    // run actions on this many workers instead of on the flow, 0 runs them on the flow
+	QueueSize int    `yaml:"queue_size,omitempty"` // events waiting per worker, default 100
+	Overflow  string `yaml:"overflow,omitempty"`   // block (default), drop_oldest or drop_newest
 }
 
 func (a Action) Derive(parent Action) Action {
@@ -44,10 +190,257 @@ func (a Action) Derive(parent Action) Action {
 	if a.SlackConcatSuffix == "" && parent.SlackConcatSuffix != "" {
 		a.SlackConcatSuffix = parent.SlackConcatSuffix
 	}
+	if a.SlackBotToken == "" && parent.SlackBotToken != "" {
+		a.SlackBotToken = parent.SlackBotToken
+	}
+	if a.SlackBotTokenFile == "" && parent.SlackBotTokenFile != "" {
+		a.SlackBotTokenFile = parent.SlackBotTokenFile
+	}
+	if a.SlackChannel == "" && parent.SlackChannel != "" {
+		a.SlackChannel = parent.SlackChannel
+	}
+	if a.SlackThread == "" && parent.SlackThread != "" {
+		a.SlackThread = parent.SlackThread
+	}
+	if a.SlackAPIURL == "" && parent.SlackAPIURL != "" {
+		a.SlackAPIURL = parent.SlackAPIURL
+	}
+	if a.SlackBlocks == nil && parent.SlackBlocks != nil {
+		a.SlackBlocks = parent.SlackBlocks
+	}
+	if a.SlackAttachments == nil && parent.SlackAttachments != nil {
+		a.SlackAttachments = parent.SlackAttachments
+	}
 	if len(a.CmdRun) == 0 && len(parent.CmdRun) > 0 {
 		a.CmdRun = make([]string, len(parent.CmdRun))
 		copy(a.CmdRun, parent.CmdRun)
 	}
+	if a.WebhookMethod == "" && parent.WebhookMethod != "" {
+		a.WebhookMethod = parent.WebhookMethod
+	}
+	if a.WebhookURL == "" && parent.WebhookURL != "" {
+		a.WebhookURL = parent.WebhookURL
+	}
+	if len(parent.WebhookHeaders) > 0 {
+		headers := make(map[string]string, len(parent.WebhookHeaders)+len(a.WebhookHeaders))
+		for k, v := range parent.WebhookHeaders {
+			headers[k] = v
+		}
+		for k, v := range a.WebhookHeaders {
+			headers[k] = v
+		}
+		a.WebhookHeaders = headers
+	}
+	if a.WebhookBodyTemplate == "" && parent.WebhookBodyTemplate != "" {
+		a.WebhookBodyTemplate = parent.WebhookBodyTemplate
+	}
+	if a.WebhookTimeoutSec == 0 && parent.WebhookTimeoutSec != 0 {
+		a.WebhookTimeoutSec = parent.WebhookTimeoutSec
+	}
+	if len(a.WebhookExpectedStatus) == 0 && len(parent.WebhookExpectedStatus) > 0 {
+		a.WebhookExpectedStatus = append([]int(nil), parent.WebhookExpectedStatus...)
+	}
+	if a.WebhookBasicAuth == nil && parent.WebhookBasicAuth != nil {
+		basicAuth := *parent.WebhookBasicAuth
+		a.WebhookBasicAuth = &basicAuth
+	}
+	if a.WebhookBearerToken == "" && parent.WebhookBearerToken != "" {
+		a.WebhookBearerToken = parent.WebhookBearerToken
+	}
+	if a.WebhookBearerTokenFile == "" && parent.WebhookBearerTokenFile != "" {
+		a.WebhookBearerTokenFile = parent.WebhookBearerTokenFile
+	}
+	if a.PagerDutyRoutingKey == "" && parent.PagerDutyRoutingKey != "" {
+		a.PagerDutyRoutingKey = parent.PagerDutyRoutingKey
+	}
+	if a.PagerDutyRoutingKeyFile == "" && parent.PagerDutyRoutingKeyFile != "" {
+		a.PagerDutyRoutingKeyFile = parent.PagerDutyRoutingKeyFile
+	}
+	if a.PagerDutyEventAction == "" && parent.PagerDutyEventAction != "" {
+		a.PagerDutyEventAction = parent.PagerDutyEventAction
+	}
+	if a.PagerDutySeverity == "" && parent.PagerDutySeverity != "" {
+		a.PagerDutySeverity = parent.PagerDutySeverity
+	}
+	if a.PagerDutySummaryTemplate == "" && parent.PagerDutySummaryTemplate != "" {
+		a.PagerDutySummaryTemplate = parent.PagerDutySummaryTemplate
+	}
+	if a.PagerDutySourceTemplate == "" && parent.PagerDutySourceTemplate != "" {
+		a.PagerDutySourceTemplate = parent.PagerDutySourceTemplate
+	}
+	if a.PagerDutyComponentTemplate == "" && parent.PagerDutyComponentTemplate != "" {
+		a.PagerDutyComponentTemplate = parent.PagerDutyComponentTemplate
+	}
+	if a.PagerDutyDedupKeyTemplate == "" && parent.PagerDutyDedupKeyTemplate != "" {
+		a.PagerDutyDedupKeyTemplate = parent.PagerDutyDedupKeyTemplate
+	}
+	if a.PagerDutyURL == "" && parent.PagerDutyURL != "" {
+		a.PagerDutyURL = parent.PagerDutyURL
+	}
+	if a.PagerDutyTimeoutSec == 0 && parent.PagerDutyTimeoutSec != 0 {
+		a.PagerDutyTimeoutSec = parent.PagerDutyTimeoutSec
+	}
+	if a.EmailSMTPHost == "" && parent.EmailSMTPHost != "" {
+		a.EmailSMTPHost = parent.EmailSMTPHost
+	}
+	if a.EmailSMTPPort == 0 && parent.EmailSMTPPort != 0 {
+		a.EmailSMTPPort = parent.EmailSMTPPort
+	}
+	if a.EmailTLS == "" && parent.EmailTLS != "" {
+		a.EmailTLS = parent.EmailTLS
+	}
+	if !a.EmailInsecureSkipVerify && parent.EmailInsecureSkipVerify {
+		a.EmailInsecureSkipVerify = parent.EmailInsecureSkipVerify
+	}
+	if a.EmailUsername == "" && parent.EmailUsername != "" {
+		a.EmailUsername = parent.EmailUsername
+	}
+	if a.EmailPassword == "" && parent.EmailPassword != "" {
+		a.EmailPassword = parent.EmailPassword
+	}
+	if a.EmailPasswordFile == "" && parent.EmailPasswordFile != "" {
+		a.EmailPasswordFile = parent.EmailPasswordFile
+	}
+	if a.EmailFrom == "" && parent.EmailFrom != "" {
+		a.EmailFrom = parent.EmailFrom
+	}
+	if len(a.EmailTo) == 0 && len(parent.EmailTo) > 0 {
+		a.EmailTo = append([]string(nil), parent.EmailTo...)
+	}
+	if len(a.EmailCc) == 0 && len(parent.EmailCc) > 0 {
+		a.EmailCc = append([]string(nil), parent.EmailCc...)
+	}
+	if a.EmailSubjectTemplate == "" && parent.EmailSubjectTemplate != "" {
+		a.EmailSubjectTemplate = parent.EmailSubjectTemplate
+	}
+	if a.EmailBodyTemplate == "" && parent.EmailBodyTemplate != "" {
+		a.EmailBodyTemplate = parent.EmailBodyTemplate
+	}
+	if a.EmailHTMLTemplate == "" && parent.EmailHTMLTemplate != "" {
+		a.EmailHTMLTemplate = parent.EmailHTMLTemplate
+	}
+	if a.EmailTimeoutSec == 0 && parent.EmailTimeoutSec != 0 {
+		a.EmailTimeoutSec = parent.EmailTimeoutSec
+	}
+	if a.EmailConcat == 0 && parent.EmailConcat != 0 {
+		a.EmailConcat = parent.EmailConcat
+	}
+	if a.TeamsWebhookURL == "" && parent.TeamsWebhookURL != "" {
+		a.TeamsWebhookURL = parent.TeamsWebhookURL
+	}
+	if a.TeamsTimeoutSec == 0 && parent.TeamsTimeoutSec != 0 {
+		a.TeamsTimeoutSec = parent.TeamsTimeoutSec
+	}
+	if a.TeamsMessageTemplate == "" && parent.TeamsMessageTemplate != "" {
+		a.TeamsMessageTemplate = parent.TeamsMessageTemplate
+	}
+	if a.TeamsCard == "" && parent.TeamsCard != "" {
+		a.TeamsCard = parent.TeamsCard
+	}
+	if a.TeamsConcat == 0 && parent.TeamsConcat != 0 {
+		a.TeamsConcat = parent.TeamsConcat
+	}
+	if a.TeamsConcatPrefix == "" && parent.TeamsConcatPrefix != "" {
+		a.TeamsConcatPrefix = parent.TeamsConcatPrefix
+	}
+	if a.TeamsConcatSuffix == "" && parent.TeamsConcatSuffix != "" {
+		a.TeamsConcatSuffix = parent.TeamsConcatSuffix
+	}
+	if a.DiscordWebhookURL == "" && parent.DiscordWebhookURL != "" {
+		a.DiscordWebhookURL = parent.DiscordWebhookURL
+	}
+	if a.DiscordTimeoutSec == 0 && parent.DiscordTimeoutSec != 0 {
+		a.DiscordTimeoutSec = parent.DiscordTimeoutSec
+	}
+	if a.DiscordMessageTemplate == "" && parent.DiscordMessageTemplate != "" {
+		a.DiscordMessageTemplate = parent.DiscordMessageTemplate
+	}
+	if a.DiscordUsername == "" && parent.DiscordUsername != "" {
+		a.DiscordUsername = parent.DiscordUsername
+	}
+	if a.DiscordConcat == 0 && parent.DiscordConcat != 0 {
+		a.DiscordConcat = parent.DiscordConcat
+	}
+	if a.DiscordConcatPrefix == "" && parent.DiscordConcatPrefix != "" {
+		a.DiscordConcatPrefix = parent.DiscordConcatPrefix
+	}
+	if a.DiscordConcatSuffix == "" && parent.DiscordConcatSuffix != "" {
+		a.DiscordConcatSuffix = parent.DiscordConcatSuffix
+	}
+	if a.MattermostWebhookURL == "" && parent.MattermostWebhookURL != "" {
+		a.MattermostWebhookURL = parent.MattermostWebhookURL
+	}
+	if a.MattermostTimeoutSec == 0 && parent.MattermostTimeoutSec != 0 {
+		a.MattermostTimeoutSec = parent.MattermostTimeoutSec
+	}
+	if a.MattermostMessageTemplate == "" && parent.MattermostMessageTemplate != "" {
+		a.MattermostMessageTemplate = parent.MattermostMessageTemplate
+	}
+	if a.MattermostUsername == "" && parent.MattermostUsername != "" {
+		a.MattermostUsername = parent.MattermostUsername
+	}
+	if a.MattermostChannel == "" && parent.MattermostChannel != "" {
+		a.MattermostChannel = parent.MattermostChannel
+	}
+	if a.MattermostIconURL == "" && parent.MattermostIconURL != "" {
+		a.MattermostIconURL = parent.MattermostIconURL
+	}
+	if a.MattermostConcat == 0 && parent.MattermostConcat != 0 {
+		a.MattermostConcat = parent.MattermostConcat
+	}
+	if a.MattermostConcatPrefix == "" && parent.MattermostConcatPrefix != "" {
+		a.MattermostConcatPrefix = parent.MattermostConcatPrefix
+	}
+	if a.MattermostConcatSuffix == "" && parent.MattermostConcatSuffix != "" {
+		a.MattermostConcatSuffix = parent.MattermostConcatSuffix
+	}
+	if a.GoogleChatWebhookURL == "" && parent.GoogleChatWebhookURL != "" {
+		a.GoogleChatWebhookURL = parent.GoogleChatWebhookURL
+	}
+	if a.GoogleChatTimeoutSec == 0 && parent.GoogleChatTimeoutSec != 0 {
+		a.GoogleChatTimeoutSec = parent.GoogleChatTimeoutSec
+	}
+	if a.GoogleChatMessageTemplate == "" && parent.GoogleChatMessageTemplate != "" {
+		a.GoogleChatMessageTemplate = parent.GoogleChatMessageTemplate
+	}
+	if a.GoogleChatConcat == 0 && parent.GoogleChatConcat != 0 {
+		a.GoogleChatConcat = parent.GoogleChatConcat
+	}
+	if a.GoogleChatConcatPrefix == "" && parent.GoogleChatConcatPrefix != "" {
+		a.GoogleChatConcatPrefix = parent.GoogleChatConcatPrefix
+	}
+	if a.GoogleChatConcatSuffix == "" && parent.GoogleChatConcatSuffix != "" {
+		a.GoogleChatConcatSuffix = parent.GoogleChatConcatSuffix
+	}
+	if a.TelegramBotToken == "" && parent.TelegramBotToken != "" {
+		a.TelegramBotToken = parent.TelegramBotToken
+	}
+	if a.TelegramBotTokenFile == "" && parent.TelegramBotTokenFile != "" {
+		a.TelegramBotTokenFile = parent.TelegramBotTokenFile
+	}
+	if a.TelegramChatID == "" && parent.TelegramChatID != "" {
+		a.TelegramChatID = parent.TelegramChatID
+	}
+	if a.TelegramMessageTemplate == "" && parent.TelegramMessageTemplate != "" {
+		a.TelegramMessageTemplate = parent.TelegramMessageTemplate
+	}
+	if a.TelegramParseMode == "" && parent.TelegramParseMode != "" {
+		a.TelegramParseMode = parent.TelegramParseMode
+	}
+	if a.TelegramAPIURL == "" && parent.TelegramAPIURL != "" {
+		a.TelegramAPIURL = parent.TelegramAPIURL
+	}
+	if a.TelegramTimeoutSec == 0 && parent.TelegramTimeoutSec != 0 {
+		a.TelegramTimeoutSec = parent.TelegramTimeoutSec
+	}
+	if a.Dispatch == nil && parent.Dispatch != nil {
+		dispatch := *parent.Dispatch
+		a.Dispatch = &dispatch
+	}
+	if a.Retry == nil && parent.Retry != nil {
+		retry := *parent.Retry
+		a.Retry = &retry
+	}
 	if a.Type == "" && parent.Type != "" {
 		a.Type = parent.Type
 	}
@@ -62,6 +455,9 @@ type Trigger struct {
 	Regex       string `yaml:"regex,omitempty"`
 	IgnoreRegex string `yaml:"ignore_regex,omitempty"`
 
+	Severity string `yaml:"severity,omitempty"` // critical, error, warning or info, available as ${values.severity}
+	Color    string `yaml:"color,omitempty"`    // e.g. #ff0000, available as ${values.color}; set from the severity by default
+
 	Lines               int    `yaml:"lines,omitempty"`
 	ActionName          string `yaml:"action,omitempty"`
 	NextLinesActionName string `yaml:"next_lines_action,omitempty"` // if lines > 0
@@ -70,13 +466,57 @@ type Trigger struct {
 	NextLinesAction *Action `yaml:"loaded_next_lines_action,omitempty"` // if lines > 0
 }
 
+// SeverityColors are the default colours of the trigger severities.
+var SeverityColors = map[string]string{
+	"critical": "#b20000",
+	"error":    "#e01e5a",
+	"warning":  "#ecb22e",
+	"info":     "#36c5f0",
+}
+
+// Flow sources
+const (
+	SourceTail   = "tail"   // Loki websocket tail
+	SourcePoll   = "poll"   // Loki query_range polling, for networks that block websockets
+	SourceFile   = "file"   // local log file
+	SourceStdin  = "stdin"  // standard input
+	SourcePush   = "push"   // lines received on the Loki push API
+	SourceSyslog = "syslog" // syslog messages received over UDP or TCP
+	SourceOTLP   = "otlp"   // OpenTelemetry log records received over OTLP/HTTP
+)
+
 type Flow struct {
 	Name     string `yaml:"name,omitempty"`
 	Abstract bool   `yaml:"abstract,omitempty"` // if true, this flow is not used directly, but is extended by other flows
 	Extends  string `yaml:"extends,omitempty"`  // extends another flow
 
-	Query    string    `yaml:"query,omitempty"`
+	Query    string `yaml:"query,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty"` // name of the loki endpoint, optional if there is only one
+	Tenant   string `yaml:"tenant,omitempty"`   // overrides the loki tenant, use a|b to query multiple tenants
+
+	Source          string `yaml:"source,omitempty"`            // tail (default), poll, file, stdin, push, syslog or otlp
+	PollIntervalSec int64  `yaml:"poll_interval_sec,omitempty"` // poll source: how often to query, default 10
+	PollOverlapSec  int64  `yaml:"poll_overlap_sec,omitempty"`  // poll source: how far each query reaches back, default 30
+
+	FilePath      string            `yaml:"file_path,omitempty"`       // file source: the log file to follow
+	FileFromStart bool              `yaml:"file_from_start,omitempty"` // file source: read existing lines too, not only new ones
+	Labels        map[string]string `yaml:"labels,omitempty"`          // file and stdin sources: static labels of the lines
+
+	Selector string `yaml:"selector,omitempty"` // receiver sources: stream selector of the received lines, e.g. {app="api"}
+
+	Limit       int    `yaml:"limit,omitempty"`        // maximum number of lines per tail response
+	DelayForSec int    `yaml:"delay_for,omitempty"`    // seconds to delay the tail so out of order lines settle, at most 5
+	StartOffset string `yaml:"start_offset,omitempty"` // on startup without checkpoint, start this far in the past, e.g. 15m
+
 	Triggers []Trigger `yaml:"triggers,omitempty"`
+
+	DroppedActionName string  `yaml:"dropped_action,omitempty"` // runs for each tail response reporting dropped lines
+	DroppedAction     *Action `yaml:"loaded_dropped_action,omitempty"`
+}
+
+// ReadsLoki tells whether the flow source is Loki.
+func (f Flow) ReadsLoki() bool {
+	return f.Source == "" || f.Source == SourceTail || f.Source == SourcePoll
 }
 
 func (f Flow) Derive(parent Flow) Flow {
@@ -86,6 +526,53 @@ func (f Flow) Derive(parent Flow) Flow {
 	if f.Query == "" && parent.Query != "" {
 		f.Query = parent.Query
 	}
+	if f.Endpoint == "" && parent.Endpoint != "" {
+		f.Endpoint = parent.Endpoint
+	}
+	if f.Tenant == "" && parent.Tenant != "" {
+		f.Tenant = parent.Tenant
+	}
+	if f.Source == "" && parent.Source != "" {
+		f.Source = parent.Source
+	}
+	if f.PollIntervalSec == 0 && parent.PollIntervalSec != 0 {
+		f.PollIntervalSec = parent.PollIntervalSec
+	}
+	if f.PollOverlapSec == 0 && parent.PollOverlapSec != 0 {
+		f.PollOverlapSec = parent.PollOverlapSec
+	}
+	if f.FilePath == "" && parent.FilePath != "" {
+		f.FilePath = parent.FilePath
+	}
+	if !f.FileFromStart && parent.FileFromStart {
+		f.FileFromStart = parent.FileFromStart
+	}
+	if len(parent.Labels) > 0 {
+		labels := make(map[string]string, len(parent.Labels)+len(f.Labels))
+		for k, v := range parent.Labels {
+			labels[k] = v
+		}
+		for k, v := range f.Labels {
+			labels[k] = v
+		}
+		f.Labels = labels
+	}
+	if f.Selector == "" && parent.Selector != "" {
+		f.Selector = parent.Selector
+	}
+	if f.Limit == 0 && parent.Limit != 0 {
+		f.Limit = parent.Limit
+	}
+	if f.DelayForSec == 0 && parent.DelayForSec != 0 {
+		f.DelayForSec = parent.DelayForSec
+	}
+	if f.StartOffset == "" && parent.StartOffset != "" {
+		f.StartOffset = parent.StartOffset
+	}
+	if f.DroppedActionName == "" && parent.DroppedActionName != "" {
+		f.DroppedActionName = parent.DroppedActionName
+		f.DroppedAction = parent.DroppedAction
+	}
 
 	// first go parent triggers, then current flow triggers
 
@@ -99,15 +586,130 @@ func (f Flow) Derive(parent Flow) Flow {
 	return f
 }
 
+type TLS struct {
+	CAFile             string `yaml:"ca_file,omitempty"`   // CA bundle to verify the server certificate
+	CertFile           string `yaml:"cert_file,omitempty"` // client certificate, requires key_file
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+type BasicAuth struct {
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"` // read the password from a file instead
+}
+
+type Backoff struct {
+	InitialDelayMs int64   `yaml:"initial_delay_ms,omitempty"` // default 1000
+	MaxDelayMs     int64   `yaml:"max_delay_ms,omitempty"`     // default 120000
+	Multiplier     float64 `yaml:"multiplier,omitempty"`       // default 2
+	Jitter         float64 `yaml:"jitter,omitempty"`           // fraction of the delay to randomize, default 0.2
+}
+
 type Loki struct {
-	Host string `yaml:"host,omitempty"`
-	Port int    `yaml:"port,omitempty"`
+	Name string `yaml:"-"` // endpoint name, set on load
+
+	Scheme string `yaml:"scheme,omitempty"` // ws (default), wss, http or https
+	Host   string `yaml:"host,omitempty"`
+	Port   int    `yaml:"port,omitempty"`
+	Tenant string `yaml:"tenant,omitempty"` // sent as X-Scope-OrgID, can be overridden per flow
+
+	TLS             *TLS              `yaml:"tls,omitempty"`
+	BasicAuth       *BasicAuth        `yaml:"basic_auth,omitempty"`
+	BearerToken     string            `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string            `yaml:"bearer_token_file,omitempty"` // read the bearer token from a file instead
+	Headers         map[string]string `yaml:"headers,omitempty"`           // extra headers sent to Loki
+
+	CategorizeLabels bool `yaml:"categorize_labels,omitempty"` // ask Loki 3 to return structured metadata and parsed labels separately
+
+	Backoff         Backoff `yaml:"backoff,omitempty"`           // reconnect delays
+	PingIntervalSec int64   `yaml:"ping_interval_sec,omitempty"` // websocket keepalive interval, default 30
+	PingTimeoutSec  int64   `yaml:"ping_timeout_sec,omitempty"`  // reconnect if a ping is not answered in time, default 10
+}
+
+// DefaultEndpoint is the name of the Loki endpoint configured without a name.
+const DefaultEndpoint = "default"
+
+// Lokis maps endpoint names to Loki connection settings. A single unnamed endpoint
+// is accepted as well and becomes the default endpoint.
+type Lokis map[string]Loki
+
+func (l *Lokis) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: loki must be a mapping", node.Line)
+	}
+
+	// a named endpoint map has only mappings as values, a single endpoint has at least
+	// a scalar value such as host or port
+	named := true
+	for i := 1; i < len(node.Content); i += 2 {
+		if node.Content[i].Kind != yaml.MappingNode {
+			named = false
+			break
+		}
+	}
+
+	if !named {
+		var single Loki
+		if err := node.Decode(&single); err != nil {
+			return err
+		}
+		*l = Lokis{DefaultEndpoint: single}
+		return nil
+	}
+
+	endpoints := make(map[string]Loki)
+	if err := node.Decode(&endpoints); err != nil {
+		return err
+	}
+	*l = endpoints
+	return nil
+}
+
+type PushReceiver struct {
+	Listen string `yaml:"listen,omitempty"` // address of the Loki push API, e.g. :3500
+}
+
+type SyslogReceiver struct {
+	UDP string `yaml:"udp,omitempty"` // address to receive syslog datagrams on, e.g. :514
+	TCP string `yaml:"tcp,omitempty"` // address to receive syslog streams on, newline or octet counting framed
+}
+
+type OTLPReceiver struct {
+	Listen string `yaml:"listen,omitempty"` // address of the OTLP/HTTP logs endpoint, e.g. :4318
+}
+
+type Receivers struct {
+	Push   PushReceiver   `yaml:"push,omitempty"`
+	Syslog SyslogReceiver `yaml:"syslog,omitempty"`
+	OTLP   OTLPReceiver   `yaml:"otlp,omitempty"`
+}
+
+type Checkpoint struct {
+	Type          string `yaml:"type,omitempty"`             // file (default)
+	Path          string `yaml:"path,omitempty"`             // checkpoints are disabled if empty
+	IntervalSec   int64  `yaml:"interval_sec,omitempty"`     // how often flows save their position
+	MaxCatchUpSec int64  `yaml:"max_catch_up_sec,omitempty"` // never resume further back than this, 0 means no limit
+}
+
+type Spool struct {
+	Path string `yaml:"path,omitempty"` // directory of the events actions failed to execute, disabled if empty
 }
 
 type Config struct {
-	Loki    Loki              `yaml:"loki,omitempty"`
-	Actions map[string]Action `yaml:"actions,omitempty"`
-	Flows   map[string]Flow   `yaml:"flows,omitempty"`
+	Loki       Lokis             `yaml:"loki,omitempty"`
+	Checkpoint Checkpoint        `yaml:"checkpoint,omitempty"`
+	Receivers  Receivers         `yaml:"receivers,omitempty"`
+	Dispatch   Dispatch          `yaml:"dispatch,omitempty"` // global worker pool of the actions
+	Spool      Spool             `yaml:"spool,omitempty"`    // dead-letter spool of the actions
+	Actions    map[string]Action `yaml:"actions,omitempty"`
+	Flows      map[string]Flow   `yaml:"flows,omitempty"`
+}
+
+// isLocalhost tells whether a host is the local machine, where credentials can be sent without TLS.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
 }
 
 func Load(path string) (*Config, error) {
@@ -124,6 +726,16 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	for name, endpoint := range config.Loki {
+		endpoint.Name = name
+		config.Loki[name] = endpoint
+	}
+
+	for name, action := range config.Actions {
+		action.Name = name
+		config.Actions[name] = action
+	}
+
 	// populate actions with fields from their base action
 
 	done := false
@@ -154,9 +766,58 @@ func Load(path string) (*Config, error) {
 		}
 	}
 
+	// select the worker pools and the spool of the actions
+	for name, action := range config.Actions {
+		switch {
+		case action.Dispatch != nil && action.Dispatch.Workers > 0:
+			action.Pool = name
+		case action.Dispatch == nil && config.Dispatch.Workers > 0:
+			dispatch := config.Dispatch
+			action.Dispatch = &dispatch
+			action.Pool = GlobalPool
+		}
+		if action.Dispatch != nil {
+			switch action.Dispatch.Overflow {
+			case "", OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+			default:
+				return nil, fmt.Errorf("action %s has unknown overflow policy %s", name, action.Dispatch.Overflow)
+			}
+		}
+		if action.Retry != nil {
+			for _, failure := range action.Retry.RetryOn {
+				switch failure {
+				case RetryNetwork, RetryRateLimit, RetryServer, RetryExit:
+				default:
+					return nil, fmt.Errorf("action %s retries unknown failure %s", name, failure)
+				}
+			}
+			if action.Pool == "" && action.Retry.MaxAttempts != 1 {
+				slog.Warn("Action retries without a worker pool, the flow stops reading while it waits to retry; configure dispatch",
+					"action", name)
+			}
+		}
+		if action.Type == "email" && action.EmailTLS == EmailNoTLS && action.EmailUsername != "" && !isLocalhost(action.EmailSMTPHost) {
+			// net/smtp refuses to send credentials in clear text to another host
+			return nil, fmt.Errorf("action %s authenticates without TLS to %s, set email_tls to starttls or tls", name, action.EmailSMTPHost)
+		}
+		action.Spool = config.Spool.Path
+		config.Actions[name] = action
+	}
+
 	// populate triggers with their actions
 	for name, flow := range config.Flows {
 		for i, trigger := range flow.Triggers {
+			if trigger.Severity != "" {
+				color, ok := SeverityColors[trigger.Severity]
+				if !ok {
+					return nil, fmt.Errorf("trigger %s has unknown severity %s", trigger.Name, trigger.Severity)
+				}
+				if trigger.Color == "" {
+					trigger.Color = color
+				}
+				config.Flows[name].Triggers[i] = trigger
+			}
+
 			action, ok := config.Actions[trigger.ActionName]
 			if !ok {
 				return nil, fmt.Errorf("trigger %s action %s not found", trigger.Name, trigger.ActionName)
@@ -173,6 +834,13 @@ func Load(path string) (*Config, error) {
 				config.Flows[name].Triggers[i] = trigger
 			}
 		}
+		if flow.DroppedActionName != "" {
+			droppedAction, ok := config.Actions[flow.DroppedActionName]
+			if !ok {
+				return nil, fmt.Errorf("flow %s dropped action %s not found", name, flow.DroppedActionName)
+			}
+			flow.DroppedAction = &droppedAction
+		}
 		flow.Name = name
 		config.Flows[name] = flow
 	}
@@ -201,5 +869,148 @@ func Load(path string) (*Config, error) {
 		}
 	}
 
+	// select loki endpoints of the flows
+	for name, flow := range config.Flows {
+		if flow.Source == SourcePush && config.Receivers.Push.Listen == "" {
+			return nil, fmt.Errorf("flow %s receives pushed lines, but the push receiver is not configured", name)
+		}
+		if flow.Source == SourceSyslog && config.Receivers.Syslog.UDP == "" && config.Receivers.Syslog.TCP == "" {
+			return nil, fmt.Errorf("flow %s receives syslog messages, but the syslog receiver is not configured", name)
+		}
+		if flow.Source == SourceOTLP && config.Receivers.OTLP.Listen == "" {
+			return nil, fmt.Errorf("flow %s receives OTLP logs, but the OTLP receiver is not configured", name)
+		}
+		if !flow.ReadsLoki() {
+			continue
+		}
+		if flow.Endpoint == "" {
+			if len(config.Loki) > 1 {
+				return nil, fmt.Errorf("flow %s must select one of the loki endpoints", name)
+			}
+			for endpoint := range config.Loki {
+				flow.Endpoint = endpoint
+			}
+			config.Flows[name] = flow
+			continue
+		}
+		if _, ok := config.Loki[flow.Endpoint]; !ok {
+			return nil, fmt.Errorf("flow %s uses unknown loki endpoint %s", name, flow.Endpoint)
+		}
+	}
+
 	return &config, nil
 }
+
+// EnableDryRun makes all actions of the flows only log what they would do.
+func (c *Config) EnableDryRun() {
+	for name, flow := range c.Flows {
+		for i := range flow.Triggers {
+			flow.Triggers[i].Action.DryRun = true
+			if flow.Triggers[i].NextLinesAction != nil {
+				nextAction := *flow.Triggers[i].NextLinesAction
+				nextAction.DryRun = true
+				flow.Triggers[i].NextLinesAction = &nextAction
+			}
+		}
+		if flow.DroppedAction != nil {
+			droppedAction := *flow.DroppedAction
+			droppedAction.DryRun = true
+			flow.DroppedAction = &droppedAction
+		}
+		c.Flows[name] = flow
+	}
+}
+
+// ReadSecret reads a password or token from a file of the configuration, ignoring surrounding whitespace.
+func ReadSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of the configuration without its secrets, to be logged.
+func (c *Config) Redacted() *Config {
+	r := *c
+
+	r.Loki = make(Lokis, len(c.Loki))
+	for name, l := range c.Loki {
+		l.BasicAuth = l.BasicAuth.redacted()
+		redact(&l.BearerToken)
+		l.Headers = redactHeaders(l.Headers)
+		r.Loki[name] = l
+	}
+
+	r.Actions = make(map[string]Action, len(c.Actions))
+	for name, a := range c.Actions {
+		r.Actions[name] = a.redacted()
+	}
+
+	r.Flows = make(map[string]Flow, len(c.Flows))
+	for name, f := range c.Flows {
+		f.Triggers = slices.Clone(f.Triggers)
+		for i, t := range f.Triggers {
+			t.Action = t.Action.redacted()
+			if t.NextLinesAction != nil {
+				nextAction := t.NextLinesAction.redacted()
+				t.NextLinesAction = &nextAction
+			}
+			f.Triggers[i] = t
+		}
+		if f.DroppedAction != nil {
+			droppedAction := f.DroppedAction.redacted()
+			f.DroppedAction = &droppedAction
+		}
+		r.Flows[name] = f
+	}
+
+	return &r
+}
+
+// redacted returns a copy of the action without its secrets. Chat webhook URLs hold the
+// credentials of the webhook, they are secrets too.
+func (a Action) redacted() Action {
+	redact(&a.SlackWebhookURL)
+	redact(&a.SlackBotToken)
+	a.WebhookHeaders = redactHeaders(a.WebhookHeaders)
+	a.WebhookBasicAuth = a.WebhookBasicAuth.redacted()
+	redact(&a.WebhookBearerToken)
+	redact(&a.PagerDutyRoutingKey)
+	redact(&a.EmailPassword)
+	redact(&a.TeamsWebhookURL)
+	redact(&a.DiscordWebhookURL)
+	redact(&a.MattermostWebhookURL)
+	redact(&a.GoogleChatWebhookURL)
+	redact(&a.TelegramBotToken)
+	return a
+}
+
+func (b *BasicAuth) redacted() *BasicAuth {
+	if b == nil {
+		return nil
+	}
+	r := *b
+	redact(&r.Password)
+	return &r
+}
+
+// redactHeaders hides all header values, any of them may carry credentials.
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	r := make(map[string]string, len(headers))
+	for k := range headers {
+		r[k] = redacted
+	}
+	return r
+}
+
+func redact(s *string) {
+	if *s != "" {
+		*s = redacted
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+func TestRedacted(t *testing.T) {
+	next := Action{SlackBotToken: "next-secret"}
+	c := &Config{
+		Loki: Lokis{DefaultEndpoint: {
+			BasicAuth:   &BasicAuth{Username: "user", Password: "loki-password"},
+			BearerToken: "loki-token",
+			Headers:     map[string]string{"Authorization": "loki-header"},
+		}},
+		Actions: map[string]Action{
+			"a": {
+				EmailPassword:       "email-password",
+				PagerDutyRoutingKey: "routing-key",
+				TelegramBotToken:    "telegram-token",
+				WebhookBearerToken:  "webhook-token",
+				WebhookBasicAuth:    &BasicAuth{Username: "user", Password: "webhook-password"},
+			},
+		},
+		Flows: map[string]Flow{
+			"f": {
+				Triggers: []Trigger{{
+					Action:          Action{DiscordWebhookURL: "https://discord.com/api/webhooks/1/secret"},
+					NextLinesAction: &next,
+				}},
+				DroppedAction: &Action{SlackWebhookURL: "https://hooks.slack.com/services/secret"},
+			},
+		},
+	}
+
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"loki-password", "loki-token", "loki-header", "email-password", "routing-key",
+		"telegram-token", "webhook-token", "webhook-password", "secret"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("%s in the redacted configuration", secret)
+		}
+	}
+	if !strings.Contains(string(out), "username: user") {
+		t.Error("username redacted")
+	}
+
+	// the configuration itself keeps its secrets
+	if c.Loki[DefaultEndpoint].BasicAuth.Password != "loki-password" || c.Loki[DefaultEndpoint].Headers["Authorization"] != "loki-header" {
+		t.Error("loki secrets changed")
+	}
+	if c.Actions["a"].WebhookBasicAuth.Password != "webhook-password" {
+		t.Error("action secrets changed")
+	}
+	if c.Flows["f"].Triggers[0].Action.DiscordWebhookURL == redacted || next.SlackBotToken != "next-secret" {
+		t.Error("flow secrets changed")
+	}
+}
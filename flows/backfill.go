@@ -0,0 +1,29 @@
+package flows
+
+import (
+	"github.com/live-labs/lokiactor/sources"
+	"log/slog"
+	"time"
+)
+
+// Backfill replays the flow triggers over the lines logged between start and end,
+// paging through query_range instead of tailing. Flows that don't read from Loki are skipped.
+func (f *Flow) Backfill(start, end time.Time) error {
+	if f.lokiOpts == nil {
+		slog.Info("Skipping backfill, the flow does not read from Loki", "flow", f.name, "source", f.sourceType)
+		return nil
+	}
+
+	slog.Info("Starting backfill", "flow", f.name, "endpoint", f.endpoint, "start", start, "end", end)
+
+	src := sources.NewLokiRange(*f.lokiOpts, start, end)
+	src.Run(f.ctx, f)
+
+	total, err := src.Result()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Backfill finished", "flow", f.name, "lines", total)
+	return nil
+}
@@ -2,32 +2,55 @@ package flows
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/coder/websocket"
 	"github.com/live-labs/lokiactor/actions"
+	"github.com/live-labs/lokiactor/checkpoint"
 	"github.com/live-labs/lokiactor/config"
-	"github.com/live-labs/lokiactor/loki"
+	"github.com/live-labs/lokiactor/sources"
 	"github.com/live-labs/lokiactor/triggers"
 	"log/slog"
-	"net/url"
+	"maps"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	tenantLabel      = "__tenant_id__" // added by Loki to streams of multi-tenant queries
+	maxDroppedListed = 20              // dropped lines listed in the message of the dropped action
+)
+
 type Flow struct {
 	ctx      context.Context
 	name     string
-	query    string
+	tenant   string
+	endpoint string // name of the loki endpoint, empty if the flow doesn't read from Loki
 	triggers []*triggers.Trigger
 
-	lokiCfg config.Loki
+	source     sources.Source
+	sourceType string
+	lokiOpts   *sources.LokiOptions // nil if the flow doesn't read from Loki
+	hub        *sources.Hub         // delivers the lines of receiver sources
+	tails      *sources.SharedTails // optional, shares tail connections between flows
+
+	droppedAction actions.Action // optional, runs for lines the source dropped
+	dropped       atomic.Int64
 
 	continuationAction actions.Action // the action to run for the multiline flow
 	continuationLines  int
+	continuationGroup  string            // event group of the multiline capture, keeps its lines in order
+	continuationOf     *triggers.Trigger // trigger of the multiline capture
+	groups             int64
+
+	pos position // last processed line, used to resume after reconnect
+
+	checkpoints   checkpoint.Store // optional, persists pos between restarts
+	checkpointCfg config.Checkpoint
 }
 
-func New(ctx context.Context, cfg config.Flow, lokiCfg config.Loki) (*Flow, error) {
+func New(ctx context.Context, cfg config.Flow, lokiCfg config.Loki, cpCfg config.Checkpoint, cpStore checkpoint.Store, hub *sources.Hub, tails *sources.SharedTails) (*Flow, error) {
 
 	tgz := make([]*triggers.Trigger, len(cfg.Triggers))
 
@@ -40,14 +63,33 @@ func New(ctx context.Context, cfg config.Flow, lokiCfg config.Loki) (*Flow, erro
 		tgz[i] = t
 	}
 
-	return &Flow{
+	var droppedAction actions.Action
+	if cfg.DroppedAction != nil {
+		a, err := actions.New(ctx, *cfg.DroppedAction)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dropped action %s: %w", cfg.DroppedAction.Type, err)
+		}
+		droppedAction = a
+	}
+
+	f := &Flow{
 		ctx:      ctx,
 		name:     cfg.Name,
-		query:    cfg.Query,
 		triggers: tgz,
+		hub:      hub,
+		tails:    tails,
+
+		droppedAction: droppedAction,
 
-		lokiCfg: lokiCfg,
-	}, nil
+		checkpoints:   cpStore,
+		checkpointCfg: cpCfg,
+	}
+
+	if err := f.newSource(cfg, lokiCfg); err != nil {
+		return nil, err
+	}
+
+	return f, nil
 }
 
 func (f *Flow) Name() string {
@@ -56,106 +98,202 @@ func (f *Flow) Name() string {
 
 func (f *Flow) Run() {
 
-	slog.Info("Starting flow", "name", f.name)
+	slog.Info("Starting flow", "name", f.name, "source", f.sourceType, "endpoint", f.endpoint)
+
+	// only Loki can resume from a point in time
+	if f.checkpoints != nil && f.lokiOpts != nil {
+		f.loadCheckpoint()
+
+		ctx, stop := context.WithCancel(f.ctx)
+		saved := make(chan struct{})
+		go func() {
+			f.saveCheckpoints(ctx)
+			close(saved)
+		}()
+		defer func() {
+			stop()
+			<-saved // wait for the final checkpoint before returning
+		}()
+	}
 
-	delay := time.Duration(0)
+	f.source.Run(f.ctx, f)
+	slog.Info("Flow stopped", "name", f.name)
+}
 
-	for {
-		select {
-		case <-f.ctx.Done():
-			slog.Info("Flow cancelled", "name", f.name)
-		case <-time.After(delay):
-		}
+// State returns the connection health of the flow source.
+func (f *Flow) State() sources.State {
+	state := f.source.State()
+	state.Dropped = f.dropped.Load()
+	return state
+}
 
-		start := time.Now().Add(-delay) // start from now - delay (in case of retry)
-		lokiURL := url.URL{
-			Scheme: "ws",
-			Host:   fmt.Sprintf("%s:%d", f.lokiCfg.Host, f.lokiCfg.Port),
-			Path:   "/loki/api/v1/tail",
+// loadCheckpoint restores the flow position saved by a previous run, limited to the
+// configured maximum catch-up window.
+func (f *Flow) loadCheckpoint() {
+	cp, ok, err := f.checkpoints.Load(f.name)
+	if err != nil {
+		slog.Error("Failed to load checkpoint", "flow", f.name, "error", err)
+		return
+	}
+	if !ok {
+		slog.Info("No checkpoint found, starting from now", "flow", f.name)
+		return
+	}
+
+	if f.checkpointCfg.MaxCatchUpSec > 0 {
+		oldest := time.Now().Add(-time.Duration(f.checkpointCfg.MaxCatchUpSec) * time.Second)
+		if cp.Ts < oldest.UnixNano() {
+			slog.Warn("Checkpoint is older than the maximum catch-up window, skipping older lines",
+				"flow", f.name, "checkpoint", time.Unix(0, cp.Ts), "resume", oldest)
+			cp = checkpoint.Checkpoint{Ts: oldest.UnixNano()}
 		}
-		query := lokiURL.Query()
-		query.Set("query", f.query)
-		query.Set("start", strconv.FormatInt(start.UnixNano(), 10))
-		lokiURL.RawQuery = query.Encode()
+	}
 
-		urlStr := lokiURL.String()
+	f.pos.restore(cp)
+	slog.Info("Resuming from checkpoint", "flow", f.name, "ts", time.Unix(0, cp.Ts))
+}
 
-		// after initial 0 delay, retry every retryInterval
-		delay = 5 * time.Second
+// saveCheckpoints periodically persists the flow position until ctx is done.
+func (f *Flow) saveCheckpoints(ctx context.Context) {
+	interval := time.Duration(f.checkpointCfg.IntervalSec) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
 
-		slog.Info("Connecting to Loki stream", "url", urlStr)
-		conn, response, err := websocket.Dial(f.ctx, urlStr, nil)
-		if err != nil {
-			slog.Error("Failed to connect to Loki stream", "error", err)
-			continue
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var saved uint64 // generation of the last saved position
+
+	save := func() {
+		cp, gen := f.pos.checkpoint()
+		if cp.Ts == 0 || gen == saved {
+			return
 		}
+		if err := f.checkpoints.Save(f.name, cp); err != nil {
+			slog.Error("Failed to save checkpoint", "flow", f.name, "error", err)
+			return
+		}
+		saved = gen
+	}
 
-		if response.StatusCode != 101 {
-			fmt.Println("Unexpected status code", response.StatusCode)
-			continue
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-t.C:
+			save()
 		}
+	}
+}
 
-		slog.Info("Connected to Loki stream", "url", urlStr)
+// ResumeFrom returns the time of the last processed line; lines sharing its timestamp may
+// not all have been delivered yet, so sources resume at that time and the duplicates are dropped.
+func (f *Flow) ResumeFrom(def time.Time) time.Time {
+	return time.Unix(0, f.pos.resumeFrom(def.UnixNano()))
+}
 
-		conn.SetReadLimit(-1)
+func (f *Flow) Settle(ts time.Time) {
+	f.pos.settle(ts.UnixNano())
+}
 
-		f.processMessages(conn)
+// ProcessDropped reports lines the source lost, e.g. Loki did not send because the tail fell behind.
+// The dropped action runs once for all the lines of a response, so a burst sends one warning.
+func (f *Flow) ProcessDropped(entries []sources.Dropped) {
+	if len(entries) == 0 {
+		return
 	}
-}
 
-func (f *Flow) processMessages(conn *websocket.Conn) {
-	for {
-		websocketMessageType, websocketMessage, err := conn.Read(f.ctx)
+	total := f.dropped.Add(int64(len(entries)))
+	slog.Warn("Log lines dropped from the stream", "flow", f.name, "endpoint", f.endpoint,
+		"dropped", len(entries), "dropped_total", total)
 
-		if err != nil {
-			slog.Error("Failed to read from websocket", "error", err)
-			break
-		}
+	var list strings.Builder
+	for i, entry := range entries {
+		slog.Debug("Dropped log line", "flow", f.name, "ts", entry.Timestamp, "labels", entry.Labels)
 
-		if websocketMessageType != websocket.MessageText {
-			slog.Warn("Unexpected websocket message type", "type", websocketMessageType)
-			continue
+		if i == maxDroppedListed {
+			fmt.Fprintf(&list, "\n... and %d more", len(entries)-i)
+			break
 		}
+		fmt.Fprintf(&list, "\n%s %s", entry.Timestamp.UTC().Format(time.RFC3339Nano), formatLabels(entry.Labels))
+	}
 
-		var event loki.Event
+	if f.droppedAction == nil {
+		return
+	}
 
-		err = json.Unmarshal(websocketMessage, &event)
-		if err != nil {
-			slog.Error("Failed to unmarshal websocket message", "error", err)
-			continue
-		}
+	values := f.values(entries[0].Labels)
+	values["dropped"] = strconv.Itoa(len(entries))
+	values["dropped_total"] = strconv.FormatInt(total, 10)
+	values["dropped_lines"] = strings.TrimPrefix(list.String(), "\n")
+
+	err := f.droppedAction.Execute(actions.Event{
+		Timestamp: entries[0].Timestamp,
+		Message:   fmt.Sprintf("%d log lines of flow %s were dropped:%s", len(entries), f.name, list.String()),
+		Labels:    entries[0].Labels,
+		Values:    values,
+	})
+	if err != nil {
+		slog.Error("Failed to run dropped action", "error", err)
+	}
+}
 
-		// we have an event, so now we have to go through all of the triggers
-		// and see if any of them match the event
+// formatLabels formats labels as a Loki stream selector, e.g. {app="api", env="prod"}.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
 
-		f.processLokiEvent(event)
+// values returns the flow specific ${values.*} variables for a line with the given labels.
+func (f *Flow) values(labels map[string]string) map[string]string {
+	tenant := f.tenant
+	if t, ok := labels[tenantLabel]; ok {
+		tenant = t // multi-tenant query, Loki tells which tenant the line belongs to
+	}
 
+	return map[string]string{
+		"tenant":   tenant,
+		"endpoint": f.endpoint,
 	}
 }
 
-func (f *Flow) processLokiEvent(event loki.Event) {
-	for _, stream := range event.Streams {
-		lines := stream.Values
-		for _, line := range lines {
-			f.processLogLine(line, stream.Details)
-		}
-	}
+// setTriggerValues makes the trigger of an event available as ${values.trigger}, ${values.severity}
+// and ${values.color}.
+func setTriggerValues(event actions.Event, trigger *triggers.Trigger) {
+	event.Values["trigger"] = trigger.Name
+	event.Values["severity"] = trigger.Severity
+	event.Values["color"] = trigger.Color
 }
 
-func (f *Flow) processLogLine(line []string, labels map[string]string) {
+// ProcessEntry runs the flow triggers for a log line.
+func (f *Flow) ProcessEntry(line sources.Entry) {
 	// available as ${values.ts}
-	ts := line[0]
+	timestamp := line.Timestamp
 
-	tsInt, err := strconv.ParseInt(ts, 10, 64)
-	if err != nil {
-		slog.Error("Failed to parse timestamp", "error", err)
+	// available as ${values.message}
+	message := line.Line
+
+	labels := line.Labels
+
+	// only Loki re-delivers lines, on reconnects and overlapping polls. Other sources may send
+	// identical lines with the same timestamp, syslog has second precision.
+	if f.lokiOpts != nil && !f.pos.advance(timestamp.UnixNano(), labels, message) {
+		slog.Debug("Skipping already processed line", "flow", f.name, "ts", timestamp.UnixNano())
 		return
 	}
 
-	timestamp := time.Unix(0, tsInt)
-
-	// available as ${values.message}
-	message := line[1]
+	event := actions.Event{
+		Timestamp: timestamp,
+		Message:   message,
+		Labels:    labels,
+		Values:    f.values(labels),
+		Metadata:  line.Metadata,
+	}
 
 	if f.continuationLines <= 0 && f.continuationAction != nil {
 		f.continuationAction = nil
@@ -165,7 +303,10 @@ func (f *Flow) processLogLine(line []string, labels map[string]string) {
 	if f.continuationAction != nil {
 		slog.Debug("Continuing multiline action", "message", message)
 
-		err = f.continuationAction.Execute(timestamp, message, labels)
+		event.Group = f.continuationGroup
+		event.Continuation = true
+		setTriggerValues(event, f.continuationOf)
+		err := f.continuationAction.Execute(event)
 		f.continuationLines--
 
 		if err != nil {
@@ -187,7 +328,14 @@ func (f *Flow) processLogLine(line []string, labels map[string]string) {
 			continue
 		}
 
-		err := trigger.Action.Execute(timestamp, message, labels)
+		setTriggerValues(event, trigger)
+
+		if trigger.Lines > 0 {
+			f.groups++
+			event.Group = fmt.Sprintf("%s/%d", f.name, f.groups)
+		}
+
+		err := trigger.Action.Execute(event)
 		if err != nil {
 			slog.Error("Failed to run action", "error", err)
 			return
@@ -199,8 +347,10 @@ func (f *Flow) processLogLine(line []string, labels map[string]string) {
 
 			f.continuationLines = trigger.Lines
 			f.continuationAction = trigger.NextLinesAction
+			f.continuationGroup = event.Group
+			f.continuationOf = trigger
 
-			err = f.continuationAction.Execute(timestamp, message, labels)
+			err = f.continuationAction.Execute(event)
 			if err != nil {
 				slog.Error("Failed to run continuation action", "error", err)
 			}
@@ -0,0 +1,54 @@
+package flows
+
+import (
+	"context"
+	"github.com/live-labs/lokiactor/actions"
+	"github.com/live-labs/lokiactor/sources"
+	"github.com/live-labs/lokiactor/triggers"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type countAction struct {
+	executed int
+}
+
+func (a *countAction) Execute(e actions.Event) error {
+	a.executed++
+	return nil
+}
+
+func TestProcessEntryDeduplication(t *testing.T) {
+	tests := []struct {
+		name     string
+		lokiOpts *sources.LokiOptions
+		want     int
+	}{
+		{"loki source", &sources.LokiOptions{}, 1},
+		{"receiver source", nil, 2},
+	}
+
+	ts := time.Unix(100, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &countAction{}
+			f := &Flow{
+				ctx:      context.Background(),
+				name:     "test",
+				lokiOpts: tt.lokiOpts,
+				triggers: []*triggers.Trigger{{Name: "all", Regex: regexp.MustCompile(".*"), Action: action}},
+				pos:      position{window: 10},
+			}
+
+			// the same line twice, a re-delivery for Loki, two messages within a second for syslog
+			for range 2 {
+				f.ProcessEntry(sources.Entry{Timestamp: ts, Line: "link down", Labels: testLabels})
+			}
+
+			if action.executed != tt.want {
+				t.Errorf("action executed %d times, want %d", action.executed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package flows
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/live-labs/lokiactor/checkpoint"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// position tracks how far a flow has got in its log stream, so a reconnect can resume
+// right where the previous connection stopped.
+type position struct {
+	mu     sync.Mutex
+	ts     int64               // nanosecond unix epoch of the newest processed line
+	window int64               // how far before ts lines are remembered, in nanoseconds
+	seen   map[string]struct{} // keys of the lines already processed within the window
+	order  []seenLine          // the same lines in timestamp order, pruned from the front
+	gen    uint64              // incremented on every change, tells whether a checkpoint is outdated
+}
+
+type seenLine struct {
+	ts  int64
+	key string
+}
+
+// advance records a line as processed. It returns false if the very same line (same
+// timestamp, labels and content) was already processed, which happens at the resume
+// boundary after a reconnect, or in the overlap of two polls.
+func (p *position) advance(ts int64, labels map[string]string, message string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ts < p.ts-p.window {
+		// out of order line from another stream, older than anything that could be a duplicate
+		return true
+	}
+
+	key := lineKey(ts, labels, message)
+
+	if _, ok := p.seen[key]; ok {
+		return false
+	}
+	if p.seen == nil {
+		p.seen = make(map[string]struct{})
+	}
+	p.seen[key] = struct{}{}
+	p.remember(seenLine{ts: ts, key: key})
+	p.gen++
+
+	if ts > p.ts {
+		p.moveTo(ts)
+	}
+
+	return true
+}
+
+// settle moves the position forward to ts, even though no line was processed there.
+func (p *position) settle(ts int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ts > p.ts {
+		p.moveTo(ts)
+	}
+}
+
+// remember adds a line to the timestamp ordered lines. Lines mostly arrive in order, an out
+// of order line is inserted close to the end.
+func (p *position) remember(l seenLine) {
+	i := len(p.order)
+	for i > 0 && p.order[i-1].ts > l.ts {
+		i--
+	}
+	p.order = slices.Insert(p.order, i, l)
+}
+
+// moveTo sets the newest timestamp and forgets lines that fell out of the window.
+func (p *position) moveTo(ts int64) {
+	p.ts = ts
+	p.gen++
+
+	n := 0
+	for n < len(p.order) && p.order[n].ts < p.ts-p.window {
+		delete(p.seen, p.order[n].key)
+		n++
+	}
+	clear(p.order[:n]) // let the keys be collected, the array is reallocated by later appends
+	p.order = p.order[n:]
+}
+
+// resumeFrom returns the timestamp to resume from, initializing the position with
+// def if nothing was processed yet.
+func (p *position) resumeFrom(def int64) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ts == 0 {
+		p.ts = def
+	}
+	return p.ts
+}
+
+// checkpoint returns the position to persist, with the generation it was taken at.
+func (p *position) checkpoint() (checkpoint.Checkpoint, uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cp := checkpoint.Checkpoint{
+		Ts:   p.ts,
+		Seen: make([]string, 0, len(p.seen)),
+	}
+	for key := range p.seen {
+		cp.Seen = append(cp.Seen, key)
+	}
+	sort.Strings(cp.Seen)
+	return cp, p.gen
+}
+
+func (p *position) restore(cp checkpoint.Checkpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ts = cp.Ts
+	p.seen = make(map[string]struct{}, len(cp.Seen))
+	p.order = make([]seenLine, 0, len(cp.Seen))
+	for _, key := range cp.Seen {
+		// exact timestamps are not persisted, keep the keys for a full window
+		p.seen[key] = struct{}{}
+		p.order = append(p.order, seenLine{ts: cp.Ts, key: key})
+	}
+}
+
+// lineKey builds an identity for a log line from its timestamp, stream labels and content.
+func lineKey(ts int64, labels map[string]string, message string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New128a()
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(ts)))
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'='})
+		h.Write([]byte(labels[k]))
+		h.Write([]byte{','})
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(message))
+	return hex.EncodeToString(h.Sum(nil))
+}
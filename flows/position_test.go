@@ -0,0 +1,210 @@
+package flows
+
+import (
+	"github.com/live-labs/lokiactor/checkpoint"
+	"testing"
+)
+
+var testLabels = map[string]string{"app": "api"}
+
+type testLine struct {
+	ts  int64
+	msg string
+}
+
+func TestPositionAdvance(t *testing.T) {
+	tests := []struct {
+		name   string
+		window int64
+		lines  []testLine
+		want   []bool
+	}{
+		{
+			name:   "new lines",
+			window: 10,
+			lines:  []testLine{{100, "a"}, {101, "b"}, {102, "c"}},
+			want:   []bool{true, true, true},
+		},
+		{
+			name:   "same line twice",
+			window: 10,
+			lines:  []testLine{{100, "a"}, {100, "a"}},
+			want:   []bool{true, false},
+		},
+		{
+			name:   "different lines sharing a timestamp",
+			window: 10,
+			lines:  []testLine{{100, "a"}, {100, "b"}, {100, "a"}},
+			want:   []bool{true, true, false},
+		},
+		{
+			name:   "out of order line within the window",
+			window: 10,
+			lines:  []testLine{{100, "a"}, {95, "b"}, {95, "b"}},
+			want:   []bool{true, true, false},
+		},
+		{
+			name:   "out of order line older than the window",
+			window: 10,
+			lines:  []testLine{{100, "a"}, {80, "b"}, {80, "b"}},
+			want:   []bool{true, true, true},
+		},
+		{
+			name:   "line pruned from the window",
+			window: 10,
+			lines:  []testLine{{100, "a"}, {120, "b"}, {100, "a"}},
+			want:   []bool{true, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &position{window: tt.window}
+			for i, l := range tt.lines {
+				if got := p.advance(l.ts, testLabels, l.msg); got != tt.want[i] {
+					t.Errorf("line %d (%d %q): advance = %v, want %v", i, l.ts, l.msg, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPositionLabelsInKey(t *testing.T) {
+	p := &position{window: 10}
+	if !p.advance(100, map[string]string{"app": "api"}, "a") {
+		t.Fatal("first line skipped")
+	}
+	if !p.advance(100, map[string]string{"app": "web"}, "a") {
+		t.Error("same line of another stream skipped")
+	}
+}
+
+func TestPositionResumeBoundary(t *testing.T) {
+	p := &position{window: 10}
+	p.advance(100, testLabels, "a")
+	p.advance(200, testLabels, "b")
+
+	// a reconnect resumes at the newest timestamp, where not all lines may have been delivered
+	if got := p.resumeFrom(0); got != 200 {
+		t.Fatalf("resumeFrom = %d, want 200", got)
+	}
+	if p.advance(200, testLabels, "b") {
+		t.Error("line at the resume boundary processed twice")
+	}
+	if !p.advance(200, testLabels, "c") {
+		t.Error("new line at the resume boundary skipped")
+	}
+}
+
+func TestPositionResumeFromDefault(t *testing.T) {
+	p := &position{window: 10}
+	if got := p.resumeFrom(500); got != 500 {
+		t.Errorf("resumeFrom = %d, want 500", got)
+	}
+	if got := p.resumeFrom(900); got != 500 {
+		t.Errorf("resumeFrom after initialization = %d, want 500", got)
+	}
+}
+
+func TestPositionSettle(t *testing.T) {
+	p := &position{window: 10}
+	p.advance(100, testLabels, "a")
+
+	p.settle(150)
+	if got := p.resumeFrom(0); got != 150 {
+		t.Errorf("resumeFrom after settle = %d, want 150", got)
+	}
+	if !p.advance(100, testLabels, "a") {
+		t.Error("line older than the settled window skipped")
+	}
+
+	p.settle(120) // never moves back
+	if got := p.resumeFrom(0); got != 150 {
+		t.Errorf("resumeFrom after settling back = %d, want 150", got)
+	}
+}
+
+func TestPositionCheckpointRestore(t *testing.T) {
+	p := &position{window: 10}
+	p.advance(100, testLabels, "a")
+	p.advance(105, testLabels, "b")
+	p.advance(105, testLabels, "c")
+
+	cp, _ := p.checkpoint()
+	if cp.Ts != 105 || len(cp.Seen) != 3 {
+		t.Fatalf("checkpoint = %d with %d keys, want 105 with 3", cp.Ts, len(cp.Seen))
+	}
+
+	r := &position{window: 10}
+	r.restore(cp)
+	if got := r.resumeFrom(0); got != 105 {
+		t.Errorf("resumeFrom after restore = %d, want 105", got)
+	}
+	for _, msg := range []string{"b", "c"} {
+		if r.advance(105, testLabels, msg) {
+			t.Errorf("line %q of the checkpoint processed again", msg)
+		}
+	}
+	if !r.advance(105, testLabels, "d") {
+		t.Error("new line after restore skipped")
+	}
+}
+
+func TestPositionRestoreKeepsKeysForAWindow(t *testing.T) {
+	p := &position{window: 10}
+	p.restore(checkpoint.Checkpoint{Ts: 100, Seen: []string{lineKey(95, testLabels, "a")}})
+
+	if p.advance(95, testLabels, "a") {
+		t.Error("restored line processed again")
+	}
+
+	p.settle(111) // the restored keys are kept for a window after the checkpoint
+	if !p.advance(95, testLabels, "a") {
+		t.Error("line older than the window skipped")
+	}
+}
+
+func TestPositionCheckpointGeneration(t *testing.T) {
+	p := &position{window: 10}
+	p.advance(100, testLabels, "a")
+	_, saved := p.checkpoint()
+
+	// a line sharing the timestamp of the saved checkpoint must be saved too
+	p.advance(100, testLabels, "b")
+	cp, gen := p.checkpoint()
+	if gen == saved {
+		t.Error("checkpoint generation unchanged by a line at the same timestamp")
+	}
+	if len(cp.Seen) != 2 {
+		t.Errorf("checkpoint has %d keys, want 2", len(cp.Seen))
+	}
+
+	p.advance(100, testLabels, "b") // duplicate, nothing changes
+	if _, again := p.checkpoint(); again != gen {
+		t.Error("checkpoint generation changed by a duplicate line")
+	}
+}
+
+func TestPositionPrunesOutOfOrderLines(t *testing.T) {
+	p := &position{window: 10}
+	for _, l := range []testLine{{100, "a"}, {105, "b"}, {102, "c"}, {108, "d"}, {101, "e"}} {
+		p.advance(l.ts, testLabels, l.msg)
+	}
+
+	p.settle(113) // forgets the lines before 103
+	if len(p.seen) != 2 || len(p.order) != 2 {
+		t.Fatalf("%d keys and %d ordered lines remembered, want 2", len(p.seen), len(p.order))
+	}
+	for _, l := range []testLine{{105, "b"}, {108, "d"}} {
+		if p.advance(l.ts, testLabels, l.msg) {
+			t.Errorf("line %q within the window processed again", l.msg)
+		}
+	}
+}
+
+func BenchmarkPositionAdvance(b *testing.B) {
+	p := &position{window: int64(b.N)} // every line stays within the window
+	for i := 0; i < b.N; i++ {
+		p.advance(int64(i), testLabels, "line")
+	}
+}
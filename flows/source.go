@@ -0,0 +1,124 @@
+package flows
+
+import (
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"github.com/live-labs/lokiactor/loki"
+	"github.com/live-labs/lokiactor/selector"
+	"github.com/live-labs/lokiactor/sources"
+	"time"
+)
+
+// newSource creates the source the flow reads its lines from.
+func (f *Flow) newSource(cfg config.Flow, lokiCfg config.Loki) error {
+	f.sourceType = cfg.Source
+	if f.sourceType == "" {
+		f.sourceType = config.SourceTail
+	}
+
+	switch cfg.Source {
+	case "", config.SourceTail, config.SourcePoll:
+		opts, err := newLokiOptions(cfg, lokiCfg)
+		if err != nil {
+			return err
+		}
+		f.lokiOpts = &opts
+		f.tenant = opts.Tenant
+		f.endpoint = opts.Endpoint
+
+		if cfg.Source != config.SourcePoll {
+			if f.tails != nil {
+				f.source = f.tails.Source(opts)
+			} else {
+				f.source = sources.NewLokiTail(opts)
+			}
+			return nil
+		}
+
+		pollInterval := time.Duration(cfg.PollIntervalSec) * time.Second
+		if pollInterval <= 0 {
+			pollInterval = 10 * time.Second
+		}
+		pollOverlap := time.Duration(cfg.PollOverlapSec) * time.Second
+		if pollOverlap <= 0 {
+			pollOverlap = 30 * time.Second
+		}
+
+		// polls overlap, lines seen in the overlap must not be processed twice
+		f.pos.window = pollOverlap.Nanoseconds()
+		f.source = sources.NewLokiPoll(opts, pollInterval, pollOverlap)
+		return nil
+
+	case config.SourceFile:
+		if cfg.FilePath == "" {
+			return fmt.Errorf("file_path is required for the file source of flow %s", cfg.Name)
+		}
+		f.source = sources.NewFile(cfg.Name, cfg.FilePath, cfg.FileFromStart, cfg.Labels)
+		return nil
+
+	case config.SourceStdin:
+		f.source = sources.NewStdin(cfg.Name, cfg.Labels)
+		return nil
+
+	case config.SourcePush, config.SourceSyslog, config.SourceOTLP:
+		sel, err := selector.Parse(cfg.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector of flow %s: %w", cfg.Name, err)
+		}
+		f.source = sources.NewReceiver(cfg.Name, cfg.Source, f.hub, sel)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown source %s of flow %s", cfg.Source, cfg.Name)
+	}
+}
+
+func newLokiOptions(cfg config.Flow, lokiCfg config.Loki) (sources.LokiOptions, error) {
+	var startOffset time.Duration
+	if cfg.StartOffset != "" {
+		d, err := time.ParseDuration(cfg.StartOffset)
+		if err != nil || d < 0 {
+			return sources.LokiOptions{}, fmt.Errorf("invalid start offset %q of flow %s", cfg.StartOffset, cfg.Name)
+		}
+		startOffset = d
+	}
+
+	if cfg.DelayForSec < 0 || cfg.DelayForSec > 5 {
+		return sources.LokiOptions{}, fmt.Errorf("delay_for of flow %s must be between 0 and 5 seconds", cfg.Name)
+	}
+
+	tenant := cfg.Tenant
+	if tenant == "" {
+		tenant = lokiCfg.Tenant
+	}
+
+	client, err := loki.NewClient(lokiCfg)
+	if err != nil {
+		return sources.LokiOptions{}, fmt.Errorf("failed to create loki client: %w", err)
+	}
+
+	pingInterval := time.Duration(lokiCfg.PingIntervalSec) * time.Second
+	if pingInterval <= 0 {
+		pingInterval = 30 * time.Second
+	}
+	pingTimeout := time.Duration(lokiCfg.PingTimeoutSec) * time.Second
+	if pingTimeout <= 0 {
+		pingTimeout = 10 * time.Second
+	}
+
+	return sources.LokiOptions{
+		Name:     cfg.Name,
+		Endpoint: lokiCfg.Name,
+		Client:   client,
+		Tenant:   tenant,
+
+		Query:       cfg.Query,
+		Limit:       cfg.Limit,
+		DelayForSec: cfg.DelayForSec,
+		StartOffset: startOffset,
+
+		Backoff:      lokiCfg.Backoff,
+		PingInterval: pingInterval,
+		PingTimeout:  pingTimeout,
+	}, nil
+}
@@ -4,5 +4,7 @@ go 1.24
 
 require (
 	github.com/coder/websocket v1.8.12
+	github.com/golang/snappy v1.0.0
+	google.golang.org/protobuf v1.36.9
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,250 @@
+package loki
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coder/websocket"
+	"github.com/live-labs/lokiactor/config"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TenantHeader is the header Loki uses to select the tenant when auth is enabled.
+const TenantHeader = "X-Scope-OrgID"
+
+// EncodingFlagsHeader asks Loki for optional response formats.
+const EncodingFlagsHeader = "X-Loki-Response-Encoding-Flags"
+
+// Client holds everything needed to talk to a Loki instance: its address, TLS
+// settings and the headers used for authentication.
+type Client struct {
+	baseURL    url.URL // http or https
+	httpClient *http.Client
+	header     http.Header
+}
+
+// NewClient creates a Loki client based on the provided configuration, reading
+// any secret files it refers to.
+func NewClient(cfg config.Loki) (*Client, error) {
+	c := &Client{
+		baseURL: url.URL{
+			Host: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		},
+		httpClient: &http.Client{},
+		header:     http.Header{},
+	}
+
+	switch cfg.Scheme {
+	case "", "ws", "http":
+		c.baseURL.Scheme = "http"
+	case "wss", "https":
+		c.baseURL.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unknown loki scheme: %s", cfg.Scheme)
+	}
+
+	if cfg.TLS != nil {
+		tlsCfg, err := newTLSConfig(*cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsCfg
+		c.httpClient.Transport = transport
+	}
+
+	for k, v := range cfg.Headers {
+		c.header.Set(k, v)
+	}
+
+	if cfg.CategorizeLabels {
+		c.header.Set(EncodingFlagsHeader, "categorize-labels")
+	}
+
+	if cfg.BasicAuth != nil {
+		password := cfg.BasicAuth.Password
+		if cfg.BasicAuth.PasswordFile != "" {
+			p, err := config.ReadSecret(cfg.BasicAuth.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read loki password: %w", err)
+			}
+			password = p
+		}
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(cfg.BasicAuth.Username, password)
+		c.header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+
+	token := cfg.BearerToken
+	if cfg.BearerTokenFile != "" {
+		t, err := config.ReadSecret(cfg.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read loki bearer token: %w", err)
+		}
+		token = t
+	}
+	if token != "" {
+		if cfg.BasicAuth != nil {
+			return nil, errors.New("loki basic_auth and bearer token are mutually exclusive")
+		}
+		c.header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c, nil
+}
+
+func newTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read loki CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in loki CA file %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load loki client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// TailParams are the parameters of the tail endpoint.
+type TailParams struct {
+	Query       string
+	Start       time.Time
+	Limit       int // maximum number of lines per response, Loki default if 0
+	DelayForSec int // delay the tail to let late lines arrive, at most 5 seconds
+}
+
+// TailURL returns the websocket URL of the tail endpoint.
+func (c *Client) TailURL(params TailParams) string {
+	u := c.baseURL
+	u.Path = "/loki/api/v1/tail"
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+
+	q := u.Query()
+	q.Set("query", params.Query)
+	q.Set("start", strconv.FormatInt(params.Start.UnixNano(), 10))
+	if params.Limit > 0 {
+		q.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if params.DelayForSec > 0 {
+		q.Set("delay_for", strconv.Itoa(params.DelayForSec))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// Tail opens a websocket connection to the tail endpoint. A non-empty tenant is sent as
+// X-Scope-OrgID, multiple tenants can be queried at once by separating them with '|'.
+func (c *Client) Tail(ctx context.Context, tailURL string, tenant string) (*websocket.Conn, *http.Response, error) {
+	header := c.header.Clone()
+	if tenant != "" {
+		header.Set(TenantHeader, tenant)
+	}
+
+	return websocket.Dial(ctx, tailURL, &websocket.DialOptions{
+		HTTPClient: c.httpClient,
+		HTTPHeader: header,
+	})
+}
+
+// QueryRangeParams are the parameters of the query_range endpoint.
+type QueryRangeParams struct {
+	Query string
+	Start time.Time // inclusive
+	End   time.Time // exclusive
+	Limit int       // maximum number of lines returned
+}
+
+type queryRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string   `json:"resultType"`
+		Result     []Stream `json:"result"`
+	} `json:"data"`
+}
+
+// QueryRange runs a log query over a time range, returning lines in forward direction.
+func (c *Client) QueryRange(ctx context.Context, params QueryRangeParams, tenant string) ([]Stream, error) {
+	u := c.baseURL
+	u.Path = "/loki/api/v1/query_range"
+
+	q := u.Query()
+	q.Set("query", params.Query)
+	q.Set("start", strconv.FormatInt(params.Start.UnixNano(), 10))
+	q.Set("end", strconv.FormatInt(params.End.UnixNano(), 10))
+	q.Set("direction", "forward")
+	if params.Limit > 0 {
+		q.Set("limit", strconv.Itoa(params.Limit))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header = c.header.Clone()
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	var result queryRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	if result.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("unexpected result type %q, query must return log lines", result.Data.ResultType)
+	}
+
+	return result.Data.Result, nil
+}
+
+// StatusError is returned when Loki answers with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, e.Body)
+}
@@ -1,10 +1,94 @@
 package loki
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type Stream struct {
 	Details map[string]string `json:"stream"`
-	Values  [][]string        `json:"values"` // nanosecond unix epoch, log line
+	Values  []Entry           `json:"values"` // nanosecond unix epoch, log line, optional metadata
+}
+
+// Entry is a single log line of a stream. Loki 3 may add a third element to the
+// [timestamp, line] pair, carrying structured metadata and parsed labels.
+type Entry struct {
+	Timestamp string // nanosecond unix epoch
+	Line      string
+	Metadata  map[string]string // structured metadata and parsed labels, may be nil
+}
+
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) < 2 || len(raw) > 3 {
+		return fmt.Errorf("unexpected stream value with %d elements", len(raw))
+	}
+
+	if err := json.Unmarshal(raw[0], &e.Timestamp); err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], &e.Line); err != nil {
+		return fmt.Errorf("invalid log line: %w", err)
+	}
+
+	e.Metadata = nil
+	if len(raw) == 3 {
+		metadata, err := parseMetadata(raw[2])
+		if err != nil {
+			return fmt.Errorf("invalid metadata: %w", err)
+		}
+		e.Metadata = metadata
+	}
+
+	return nil
+}
+
+// parseMetadata accepts both a flat map of structured metadata and the categorized
+// form {"structuredMetadata": {...}, "parsed": {...}}.
+func parseMetadata(data []byte) (map[string]string, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string)
+
+	categorized := false
+	for _, category := range []string{"parsed", "structuredMetadata"} { // structured metadata wins on conflicts
+		raw, ok := obj[category]
+		if !ok || len(raw) == 0 || raw[0] != '{' {
+			continue
+		}
+		var m map[string]string
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", category, err)
+		}
+		for k, v := range m {
+			metadata[k] = v
+		}
+		categorized = true
+	}
+
+	if categorized {
+		return metadata, nil
+	}
+
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// DroppedEntry is a line Loki skipped because the tail client fell behind.
+type DroppedEntry struct {
+	Labels    map[string]string `json:"labels"`
+	Timestamp string            `json:"timestamp"` // nanosecond unix epoch
 }
 
 type Event struct {
-	Streams []Stream `json:"streams"`
+	Streams        []Stream       `json:"streams"`
+	DroppedEntries []DroppedEntry `json:"dropped_entries,omitempty"`
 }
@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/live-labs/lokiactor/actions"
+	"github.com/live-labs/lokiactor/checkpoint"
 	"github.com/live-labs/lokiactor/config"
 	"github.com/live-labs/lokiactor/flows"
+	"github.com/live-labs/lokiactor/receivers"
+	"github.com/live-labs/lokiactor/sources"
 	"gopkg.in/yaml.v3"
 	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
 func main() {
@@ -26,6 +34,11 @@ func main() {
 	}
 
 	argConfigFile := flag.String("config", "./lokiactor.yml", "Configuration file for the application")
+	argBackfillFrom := flag.String("backfill-from", "", "Replay triggers over lines logged since this RFC3339 time instead of tailing")
+	argBackfillTo := flag.String("backfill-to", "", "End of the backfill window as RFC3339 time, defaults to now")
+	argDryRun := flag.Bool("dry-run", false, "Log what actions would do instead of running them")
+	argSpoolList := flag.Bool("spool-list", false, "List the events actions failed to execute and exit")
+	argSpoolReplay := flag.Bool("spool-replay", false, "Run the actions again for the spooled events, all of them or the ids given as arguments, and exit")
 	flag.Parse()
 
 	slog.Info("Using configuration file", "file", *argConfigFile)
@@ -36,19 +49,50 @@ func main() {
 		os.Exit(1)
 	}
 
-	sb := strings.Builder{}
-	enc := yaml.NewEncoder(&sb)
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		sb := strings.Builder{}
+		enc := yaml.NewEncoder(&sb)
 
-	enc.SetIndent(2)
-	err = enc.Encode(cfg)
+		enc.SetIndent(2)
+		err = enc.Encode(cfg.Redacted())
 
-	if err != nil {
-		slog.Error("Failed to re-encode configuration", "error", err)
-		os.Exit(1)
+		if err != nil {
+			slog.Error("Failed to re-encode configuration", "error", err)
+			os.Exit(1)
+		}
+
+		slog.Debug("Configuration loaded:")
+		fmt.Println(sb.String())
 	}
 
-	slog.Debug("Configuration loaded:")
-	fmt.Println(sb.String())
+	if *argDryRun {
+		slog.Info("Dry run, actions will only be logged")
+		cfg.EnableDryRun()
+	}
+
+	if *argSpoolList {
+		if err := listSpool(cfg); err != nil {
+			slog.Error("Failed to list the spool", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *argSpoolReplay {
+		if err := replaySpool(cfg, flag.Args(), *argDryRun); err != nil {
+			slog.Error("Spool replay failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *argBackfillFrom != "" {
+		if err := backfill(cfg, *argBackfillFrom, *argBackfillTo); err != nil {
+			slog.Error("Backfill failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	ch := make(chan os.Signal, 1)
@@ -59,24 +103,257 @@ func main() {
 		cancel()
 	}()
 
+	cpStore, err := checkpoint.New(cfg.Checkpoint)
+	if err != nil {
+		slog.Error("Failed to open checkpoint store", "error", err)
+		os.Exit(1)
+	}
+
+	hub := sources.NewHub()
+	tails := sources.NewSharedTails()
+
 	fls := make([]*flows.Flow, 0, len(cfg.Flows))
 
 	for _, flowCfg := range cfg.Flows {
-		flow, err := flows.New(ctx, flowCfg, cfg.Loki)
+		flow, err := flows.New(ctx, flowCfg, cfg.Loki[flowCfg.Endpoint], cfg.Checkpoint, cpStore, hub, tails)
 		if err != nil {
 			slog.Error("Failed to create flow", "error", err)
 			os.Exit(1)
 		}
 		fls = append(fls, flow)
-		slog.Debug("Flow created", "name", flowCfg.Name, "query", flowCfg.Query)
+		slog.Debug("Flow created", "name", flowCfg.Name, "endpoint", flowCfg.Endpoint, "query", flowCfg.Query)
+	}
+
+	wg := sync.WaitGroup{}
+
+	if cfg.Receivers.Push.Listen != "" {
+		push := receivers.NewPush(cfg.Receivers.Push, hub)
+		go func() {
+			if err := push.Run(ctx); err != nil {
+				slog.Error("Push receiver failed", "error", err)
+				cancel()
+			}
+		}()
+	}
+
+	if cfg.Receivers.Syslog.UDP != "" || cfg.Receivers.Syslog.TCP != "" {
+		syslog := receivers.NewSyslog(cfg.Receivers.Syslog, hub)
+		go func() {
+			if err := syslog.Run(ctx); err != nil {
+				slog.Error("Syslog receiver failed", "error", err)
+				cancel()
+			}
+		}()
+	}
+
+	if cfg.Receivers.OTLP.Listen != "" {
+		otlp := receivers.NewOTLP(cfg.Receivers.OTLP, hub)
+		go func() {
+			if err := otlp.Run(ctx); err != nil {
+				slog.Error("OTLP receiver failed", "error", err)
+				cancel()
+			}
+		}()
 	}
 
 	for _, flow := range fls {
-		go flow.Run()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			flow.Run()
+		}()
 		slog.Debug("Flow started", "name", flow.Name())
 	}
 
+	// stop when all flows are done, e.g. stdin flows reached the end of input
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	// report connection health of all flows on SIGUSR1
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-usr1:
+				for _, flow := range fls {
+					state := flow.State()
+					slog.Info("Flow state", "name", flow.Name(), "state", state.State, "since", state.Since,
+						"attempts", state.Attempts, "last_error", state.LastError, "dropped", state.Dropped)
+				}
+			}
+		}
+	}()
+
 	<-ctx.Done()
+	wg.Wait()
+	actions.Drain() // run the actions still queued on worker pools
 	slog.Info("Loki-actor terminated")
 
 }
+
+// backfill runs all flows over a historical window and returns when done.
+func backfill(cfg *config.Config, from, to string) error {
+	start, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return fmt.Errorf("invalid backfill start: %w", err)
+	}
+
+	end := time.Now()
+	if to != "" {
+		end, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return fmt.Errorf("invalid backfill end: %w", err)
+		}
+	}
+
+	if !start.Before(end) {
+		return fmt.Errorf("backfill start %s is not before end %s", start, end)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer func() {
+		cancel()
+		actions.Drain() // run the actions still queued on worker pools
+	}()
+
+	for _, flowCfg := range cfg.Flows {
+		flow, err := flows.New(ctx, flowCfg, cfg.Loki[flowCfg.Endpoint], cfg.Checkpoint, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create flow: %w", err)
+		}
+
+		if err := flow.Backfill(start, end); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listSpool prints the events actions failed to execute.
+func listSpool(cfg *config.Config) error {
+	if cfg.Spool.Path == "" {
+		return errors.New("the spool is not configured")
+	}
+
+	records, err := actions.NewSpool(cfg.Spool.Path).List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFAILED\tACTION\tERROR\tMESSAGE")
+	for _, r := range records {
+		message := r.Event.Message
+		if len(message) > 80 {
+			message = message[:77] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ID, r.Failed.Format(time.RFC3339), r.Action, r.Error, message)
+	}
+	return w.Flush()
+}
+
+// replaySpool runs the actions again for the spooled events, removing the ones that succeed.
+func replaySpool(cfg *config.Config, ids []string, dryRun bool) error {
+	if cfg.Spool.Path == "" {
+		return errors.New("the spool is not configured")
+	}
+
+	spool := actions.NewSpool(cfg.Spool.Path)
+	records, err := spool.List()
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replayed := make(map[string]actions.Action)
+	failed := 0
+
+	for _, r := range records {
+		if len(wanted) > 0 && !wanted[r.ID] {
+			continue
+		}
+
+		action, ok := replayed[r.Action]
+		if !ok {
+			actionCfg, ok := cfg.Actions[r.Action]
+			if !ok {
+				slog.Error("Spooled event of unknown action", "id", r.ID, "action", r.Action)
+				failed++
+				continue
+			}
+
+			// run the events one by one, and keep the record of an event failing again
+			actionCfg.Pool = ""
+			actionCfg.Spool = ""
+			actionCfg.SlackConcat = 0
+			actionCfg.EmailConcat = 0
+			actionCfg.TeamsConcat = 0
+			actionCfg.DiscordConcat = 0
+			actionCfg.MattermostConcat = 0
+			actionCfg.GoogleChatConcat = 0
+			actionCfg.DryRun = dryRun
+
+			action, err = actions.New(ctx, actionCfg)
+			if err != nil {
+				return fmt.Errorf("failed to create action %s: %w", r.Action, err)
+			}
+			replayed[r.Action] = action
+		}
+
+		if err := action.Execute(r.Event); err != nil {
+			slog.Error("Replay failed, the event stays in the spool", "id", r.ID, "action", r.Action, "error", err)
+			failed++
+			if !dryRun {
+				keepDelivered(spool, r, err)
+			}
+			continue
+		}
+		if dryRun {
+			continue
+		}
+
+		if err := spool.Remove(r.ID); err != nil {
+			return fmt.Errorf("failed to remove replayed event %s: %w", r.ID, err)
+		}
+		slog.Info("Replayed spooled event", "id", r.ID, "action", r.Action)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d spooled events could not be replayed", failed)
+	}
+	return nil
+}
+
+// keepDelivered replaces the record of an event failing again after more parts of its message
+// were delivered, so the next replay doesn't send them again.
+func keepDelivered(spool *actions.Spool, r actions.SpoolRecord, err error) {
+	var failure *actions.Failure
+	if !errors.As(err, &failure) || failure.Part <= r.Event.Part {
+		return
+	}
+
+	r.Event.Part = failure.Part
+	id, perr := spool.Put(r.Action, r.Event, err)
+	if perr != nil {
+		slog.Error("Failed to spool the rest of the event", "id", r.ID, "action", r.Action, "error", perr)
+		return
+	}
+	if rerr := spool.Remove(r.ID); rerr != nil {
+		slog.Error("Failed to remove replayed event", "id", r.ID, "action", r.Action, "error", rerr)
+		return
+	}
+	slog.Info("Spooled the rest of the event", "id", id, "replaces", r.ID, "action", r.Action)
+}
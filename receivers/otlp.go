@@ -0,0 +1,502 @@
+package receivers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"github.com/live-labs/lokiactor/sources"
+	"google.golang.org/protobuf/encoding/protowire"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KindOTLP is the receiver kind of OpenTelemetry log records.
+const KindOTLP = config.SourceOTLP
+
+// otlpSeverities names the ranges of the OpenTelemetry severity numbers, 1-4 are trace, 5-8 debug and so on.
+var otlpSeverities = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// OTLP accepts log records exported over OTLP/HTTP, for services instrumented with
+// OpenTelemetry only. Resource and log record attributes become labels, the body the line.
+type OTLP struct {
+	listen string
+	hub    *sources.Hub
+}
+
+func NewOTLP(cfg config.OTLPReceiver, hub *sources.Hub) *OTLP {
+	return &OTLP{
+		listen: cfg.Listen,
+		hub:    hub,
+	}
+}
+
+// Run serves the OTLP/HTTP logs endpoint until ctx is done.
+func (o *OTLP) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/logs", o.handleLogs)
+
+	return serveHTTP(ctx, KindOTLP, o.listen, mux)
+}
+
+func (o *OTLP) handleLogs(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var resourceLogs []otlpResourceLogs
+	switch contentType {
+	case "application/json":
+		resourceLogs, err = decodeOTLPJSON(body)
+	case "application/x-protobuf":
+		resourceLogs, err = decodeOTLPProto(body)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content type %s", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		slog.Warn("Rejected OTLP logs request", "remote", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	received := time.Now()
+	var entries []sources.Entry
+	for _, rl := range resourceLogs {
+		for _, record := range rl.records {
+			entries = append(entries, record.entry(rl.attributes, received))
+		}
+	}
+
+	if err := o.hub.Publish(r.Context(), KindOTLP, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// an empty ExportLogsServiceResponse means all records were accepted
+	w.Header().Set("Content-Type", contentType)
+	if contentType == "application/json" {
+		w.Write([]byte("{}"))
+	}
+}
+
+type otlpKeyValue struct {
+	key   string
+	value any // string, bool, int64, float64, []byte, []any or map[string]any
+}
+
+type otlpResourceLogs struct {
+	attributes []otlpKeyValue
+	records    []otlpLogRecord
+}
+
+type otlpLogRecord struct {
+	time           uint64
+	observedTime   uint64
+	severityNumber int64
+	severityText   string
+	body           any
+	attributes     []otlpKeyValue
+	traceID        []byte
+	spanID         []byte
+}
+
+// entry converts a log record to a line, the record attributes take precedence over
+// the resource attributes of the same name.
+func (r otlpLogRecord) entry(resource []otlpKeyValue, received time.Time) sources.Entry {
+	labels := make(map[string]string, len(resource)+len(r.attributes)+1)
+	for _, kv := range resource {
+		labels[otlpLabelName(kv.key)] = otlpString(kv.value)
+	}
+	for _, kv := range r.attributes {
+		labels[otlpLabelName(kv.key)] = otlpString(kv.value)
+	}
+
+	severity := strings.ToLower(r.severityText)
+	if severity == "" && r.severityNumber > 0 {
+		severity = otlpSeverities[min(int(r.severityNumber-1)/4, len(otlpSeverities)-1)]
+	}
+	if severity != "" {
+		labels["severity"] = severity
+	}
+
+	metadata := map[string]string{}
+	if len(r.traceID) > 0 {
+		metadata["trace_id"] = hex.EncodeToString(r.traceID)
+	}
+	if len(r.spanID) > 0 {
+		metadata["span_id"] = hex.EncodeToString(r.spanID)
+	}
+
+	ts := received
+	if r.time > 0 {
+		ts = time.Unix(0, int64(r.time))
+	} else if r.observedTime > 0 {
+		ts = time.Unix(0, int64(r.observedTime))
+	}
+
+	return sources.Entry{
+		Timestamp: ts,
+		Line:      otlpString(r.body),
+		Labels:    labels,
+		Metadata:  metadata,
+	}
+}
+
+// otlpLabelName turns an attribute name like service.name into a label name like service_name,
+// as Loki does.
+func otlpLabelName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// otlpString formats an attribute or body value, arrays and maps as JSON.
+func otlpString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// OTLP/JSON encoding of ExportLogsServiceRequest, 64 bit integers may be sent as strings.
+
+type otlpJSONRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			LogRecords []struct {
+				TimeUnixNano         json.Number        `json:"timeUnixNano"`
+				ObservedTimeUnixNano json.Number        `json:"observedTimeUnixNano"`
+				SeverityNumber       int64              `json:"severityNumber"`
+				SeverityText         string             `json:"severityText"`
+				Body                 otlpJSONAnyValue   `json:"body"`
+				Attributes           []otlpJSONKeyValue `json:"attributes"`
+				TraceID              string             `json:"traceId"`
+				SpanID               string             `json:"spanId"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string           `json:"key"`
+	Value otlpJSONAnyValue `json:"value"`
+}
+
+type otlpJSONAnyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    json.Number `json:"intValue"`
+	DoubleValue *float64    `json:"doubleValue"`
+	BytesValue  []byte      `json:"bytesValue"`
+	ArrayValue  *struct {
+		Values []otlpJSONAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []otlpJSONKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+}
+
+func (v otlpJSONAnyValue) value() any {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != "":
+		i, _ := v.IntValue.Int64()
+		return i
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		return v.BytesValue
+	case v.ArrayValue != nil:
+		values := make([]any, len(v.ArrayValue.Values))
+		for i, av := range v.ArrayValue.Values {
+			values[i] = av.value()
+		}
+		return values
+	case v.KvlistValue != nil:
+		values := make(map[string]any, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			values[kv.Key] = kv.Value.value()
+		}
+		return values
+	}
+	return nil
+}
+
+func otlpJSONAttributes(attributes []otlpJSONKeyValue) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, len(attributes))
+	for i, kv := range attributes {
+		kvs[i] = otlpKeyValue{key: kv.Key, value: kv.Value.value()}
+	}
+	return kvs
+}
+
+func decodeOTLPJSON(body []byte) ([]otlpResourceLogs, error) {
+	var req otlpJSONRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid OTLP logs request: %w", err)
+	}
+
+	resourceLogs := make([]otlpResourceLogs, 0, len(req.ResourceLogs))
+	for _, rl := range req.ResourceLogs {
+		res := otlpResourceLogs{attributes: otlpJSONAttributes(rl.Resource.Attributes)}
+
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				record := otlpLogRecord{
+					severityNumber: lr.SeverityNumber,
+					severityText:   lr.SeverityText,
+					body:           lr.Body.value(),
+					attributes:     otlpJSONAttributes(lr.Attributes),
+				}
+
+				var err error
+				if record.time, err = otlpJSONUint(lr.TimeUnixNano); err != nil {
+					return nil, fmt.Errorf("invalid timeUnixNano: %w", err)
+				}
+				if record.observedTime, err = otlpJSONUint(lr.ObservedTimeUnixNano); err != nil {
+					return nil, fmt.Errorf("invalid observedTimeUnixNano: %w", err)
+				}
+				if record.traceID, err = hex.DecodeString(lr.TraceID); err != nil {
+					return nil, fmt.Errorf("invalid traceId: %w", err)
+				}
+				if record.spanID, err = hex.DecodeString(lr.SpanID); err != nil {
+					return nil, fmt.Errorf("invalid spanId: %w", err)
+				}
+
+				res.records = append(res.records, record)
+			}
+		}
+
+		resourceLogs = append(resourceLogs, res)
+	}
+	return resourceLogs, nil
+}
+
+func otlpJSONUint(n json.Number) (uint64, error) {
+	if n == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(n), 10, 64)
+}
+
+// decodeOTLPProto decodes ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+func decodeOTLPProto(body []byte) ([]otlpResourceLogs, error) {
+	var resourceLogs []otlpResourceLogs
+
+	err := walkFields(body, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		rl, err := decodeOTLPResourceLogs(v)
+		if err != nil {
+			return err
+		}
+		resourceLogs = append(resourceLogs, rl)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP logs request: %w", err)
+	}
+	return resourceLogs, nil
+}
+
+// decodeOTLPResourceLogs decodes ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+// with Resource { repeated KeyValue attributes = 1; } and ScopeLogs { repeated LogRecord log_records = 2; }
+func decodeOTLPResourceLogs(data []byte) (otlpResourceLogs, error) {
+	var rl otlpResourceLogs
+
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			attributes, err := decodeOTLPKeyValues(v)
+			if err != nil {
+				return err
+			}
+			rl.attributes = attributes
+		case 2:
+			return walkFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num != 2 || typ != protowire.BytesType {
+					return nil
+				}
+				record, err := decodeOTLPLogRecord(v)
+				if err != nil {
+					return err
+				}
+				rl.records = append(rl.records, record)
+				return nil
+			})
+		}
+		return nil
+	})
+	return rl, err
+}
+
+// decodeOTLPLogRecord decodes LogRecord { fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2;
+// string severity_text = 3; AnyValue body = 5; repeated KeyValue attributes = 6; bytes trace_id = 9;
+// bytes span_id = 10; fixed64 observed_time_unix_nano = 11; }
+func decodeOTLPLogRecord(data []byte) (otlpLogRecord, error) {
+	var r otlpLogRecord
+
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			r.time, _ = protowire.ConsumeFixed64(v)
+		case num == 11 && typ == protowire.Fixed64Type:
+			r.observedTime, _ = protowire.ConsumeFixed64(v)
+		case num == 2 && typ == protowire.VarintType:
+			n, _ := protowire.ConsumeVarint(v)
+			r.severityNumber = int64(n)
+		case num == 3 && typ == protowire.BytesType:
+			r.severityText = string(v)
+		case num == 5 && typ == protowire.BytesType:
+			body, err := decodeOTLPAnyValue(v)
+			if err != nil {
+				return err
+			}
+			r.body = body
+		case num == 6 && typ == protowire.BytesType:
+			kv, err := decodeOTLPKeyValue(v)
+			if err != nil {
+				return err
+			}
+			r.attributes = append(r.attributes, kv)
+		case num == 9 && typ == protowire.BytesType:
+			r.traceID = v
+		case num == 10 && typ == protowire.BytesType:
+			r.spanID = v
+		}
+		return nil
+	})
+	return r, err
+}
+
+// decodeOTLPKeyValues decodes the repeated KeyValue attributes = 1 of Resource and KeyValueList.
+func decodeOTLPKeyValues(data []byte) ([]otlpKeyValue, error) {
+	var kvs []otlpKeyValue
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		kv, err := decodeOTLPKeyValue(v)
+		if err != nil {
+			return err
+		}
+		kvs = append(kvs, kv)
+		return nil
+	})
+	return kvs, err
+}
+
+// decodeOTLPKeyValue decodes KeyValue { string key = 1; AnyValue value = 2; }
+func decodeOTLPKeyValue(data []byte) (otlpKeyValue, error) {
+	var kv otlpKeyValue
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			kv.key = string(v)
+		case 2:
+			value, err := decodeOTLPAnyValue(v)
+			if err != nil {
+				return err
+			}
+			kv.value = value
+		}
+		return nil
+	})
+	return kv, err
+}
+
+// decodeOTLPAnyValue decodes AnyValue { oneof value { string string_value = 1; bool bool_value = 2;
+// int64 int_value = 3; double double_value = 4; ArrayValue array_value = 5; KeyValueList kvlist_value = 6;
+// bytes bytes_value = 7; } }
+func decodeOTLPAnyValue(data []byte) (any, error) {
+	var value any
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			value = string(v)
+		case num == 2 && typ == protowire.VarintType:
+			n, _ := protowire.ConsumeVarint(v)
+			value = n != 0
+		case num == 3 && typ == protowire.VarintType:
+			n, _ := protowire.ConsumeVarint(v)
+			value = int64(n)
+		case num == 4 && typ == protowire.Fixed64Type:
+			n, _ := protowire.ConsumeFixed64(v)
+			value = math.Float64frombits(n)
+		case num == 5 && typ == protowire.BytesType:
+			// ArrayValue { repeated AnyValue values = 1; }
+			values := []any{}
+			err := walkFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num != 1 || typ != protowire.BytesType {
+					return nil
+				}
+				av, err := decodeOTLPAnyValue(v)
+				values = append(values, av)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			value = values
+		case num == 6 && typ == protowire.BytesType:
+			// KeyValueList { repeated KeyValue values = 1; }
+			kvs, err := decodeOTLPKeyValues(v)
+			if err != nil {
+				return err
+			}
+			values := make(map[string]any, len(kvs))
+			for _, kv := range kvs {
+				values[kv.key] = kv.value
+			}
+			value = values
+		case num == 7 && typ == protowire.BytesType:
+			value = v
+		}
+		return nil
+	})
+	return value, err
+}
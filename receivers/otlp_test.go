@@ -0,0 +1,303 @@
+package receivers
+
+import (
+	"github.com/live-labs/lokiactor/sources"
+	"google.golang.org/protobuf/encoding/protowire"
+	"maps"
+	"math"
+	"testing"
+	"time"
+)
+
+// otlpExampleJSON is the logs example of opentelemetry-proto, as the collector exports it.
+const otlpExampleJSON = `{
+  "resourceLogs": [
+    {
+      "resource": {
+        "attributes": [
+          {"key": "service.name", "value": {"stringValue": "my.service"}}
+        ]
+      },
+      "scopeLogs": [
+        {
+          "scope": {
+            "name": "my.library",
+            "version": "1.0.0",
+            "attributes": [{"key": "my.scope.attribute", "value": {"stringValue": "some scope attribute"}}]
+          },
+          "logRecords": [
+            {
+              "timeUnixNano": "1544712660300000000",
+              "observedTimeUnixNano": "1544712660300000000",
+              "severityNumber": 10,
+              "severityText": "Information",
+              "traceId": "5B8EFFF798038103D269B633813FC60C",
+              "spanId": "EEE19B7EC3C1B174",
+              "body": {"stringValue": "Example log record"},
+              "attributes": [
+                {"key": "string.attribute", "value": {"stringValue": "some string"}},
+                {"key": "boolean.attribute", "value": {"boolValue": true}},
+                {"key": "int.attribute", "value": {"intValue": "10"}},
+                {"key": "double.attribute", "value": {"doubleValue": 637.704}},
+                {"key": "array.attribute", "value": {"arrayValue": {"values": [{"stringValue": "many"}, {"stringValue": "values"}]}}},
+                {"key": "map.attribute", "value": {"kvlistValue": {"values": [{"key": "some.map.key", "value": {"stringValue": "some value"}}]}}}
+              ]
+            },
+            {
+              "observedTimeUnixNano": 1544712661000000000,
+              "severityNumber": 17,
+              "body": {"bytesValue": "aGVsbG8="},
+              "attributes": [{"key": "service.name", "value": {"stringValue": "override"}}]
+            },
+            {
+              "severityNumber": 24,
+              "body": {"intValue": 42}
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}`
+
+// otlpEntries converts the decoded records like handleLogs does.
+func otlpEntries(resourceLogs []otlpResourceLogs, received time.Time) []sources.Entry {
+	var entries []sources.Entry
+	for _, rl := range resourceLogs {
+		for _, record := range rl.records {
+			entries = append(entries, record.entry(rl.attributes, received))
+		}
+	}
+	return entries
+}
+
+func checkOTLPEntries(t *testing.T, got, want []sources.Entry) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		e := got[i]
+		if !e.Timestamp.Equal(w.Timestamp) || e.Line != w.Line || !maps.Equal(e.Labels, w.Labels) || !maps.Equal(e.Metadata, w.Metadata) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func TestDecodeOTLPJSON(t *testing.T) {
+	received := time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	resourceLogs, err := decodeOTLPJSON([]byte(otlpExampleJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkOTLPEntries(t, otlpEntries(resourceLogs, received), []sources.Entry{
+		{
+			Timestamp: time.Unix(0, 1544712660300000000),
+			Line:      "Example log record",
+			Labels: map[string]string{
+				"service_name":      "my.service",
+				"string_attribute":  "some string",
+				"boolean_attribute": "true",
+				"int_attribute":     "10",
+				"double_attribute":  "637.704",
+				"array_attribute":   `["many","values"]`,
+				"map_attribute":     `{"some.map.key":"some value"}`,
+				"severity":          "information",
+			},
+			Metadata: map[string]string{"trace_id": "5b8efff798038103d269b633813fc60c", "span_id": "eee19b7ec3c1b174"},
+		},
+		{
+			Timestamp: time.Unix(0, 1544712661000000000),
+			Line:      "aGVsbG8=",
+			Labels:    map[string]string{"service_name": "override", "severity": "error"},
+			Metadata:  map[string]string{},
+		},
+		{
+			Timestamp: received,
+			Line:      "42",
+			Labels:    map[string]string{"service_name": "my.service", "severity": "fatal"},
+			Metadata:  map[string]string{},
+		},
+	})
+}
+
+func TestDecodeOTLPJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not json", `resourceLogs`},
+		{"truncated", otlpExampleJSON[:len(otlpExampleJSON)/2]},
+		{"invalid time", `{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"timeUnixNano": "yesterday"}]}]}]}`},
+		{"negative time", `{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"timeUnixNano": "-1"}]}]}]}`},
+		{"invalid observed time", `{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"observedTimeUnixNano": 1.5}]}]}]}`},
+		{"invalid trace id", `{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"traceId": "not hex"}]}]}]}`},
+		{"odd span id", `{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"spanId": "abc"}]}]}]}`},
+		{"invalid bytes", `{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"body": {"bytesValue": "!!"}}]}]}]}`},
+		{"records not a list", `{"resourceLogs": [{"scopeLogs": [{"logRecords": {}}]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resourceLogs, err := decodeOTLPJSON([]byte(tt.body)); err == nil {
+				t.Errorf("decoded %d resource logs, want an error", len(resourceLogs))
+			}
+		})
+	}
+}
+
+// otlpField appends a length delimited field.
+func otlpField(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func otlpStringValue(s string) []byte {
+	return otlpField(nil, 1, []byte(s))
+}
+
+func otlpKV(key string, value []byte) []byte {
+	return otlpField(otlpField(nil, 1, []byte(key)), 2, value)
+}
+
+// otlpProtoRequest encodes the records, each a list of LogRecord fields, as an
+// ExportLogsServiceRequest with a single resource and scope.
+func otlpProtoRequest(resource [][]byte, records ...[]byte) []byte {
+	var res []byte
+	for _, kv := range resource {
+		res = otlpField(res, 1, kv)
+	}
+
+	var scope []byte
+	scope = otlpField(scope, 1, otlpField(nil, 1, []byte("my.library"))) // InstrumentationScope, ignored
+	for _, r := range records {
+		scope = otlpField(scope, 2, r)
+	}
+
+	var rl []byte
+	rl = otlpField(rl, 1, res)
+	rl = otlpField(rl, 2, scope)
+	return otlpField(nil, 1, rl)
+}
+
+func otlpProtoRecord() []byte {
+	var r []byte
+	r = protowire.AppendTag(r, 1, protowire.Fixed64Type)
+	r = protowire.AppendFixed64(r, 1544712660300000000)
+	r = protowire.AppendTag(r, 2, protowire.VarintType)
+	r = protowire.AppendVarint(r, 9)
+	r = otlpField(r, 3, []byte("INFO"))
+	r = otlpField(r, 5, otlpStringValue("Example log record"))
+
+	var boolValue, intValue, doubleValue []byte
+	boolValue = protowire.AppendTag(boolValue, 2, protowire.VarintType)
+	boolValue = protowire.AppendVarint(boolValue, 1)
+	intValue = protowire.AppendTag(intValue, 3, protowire.VarintType)
+	negative := int64(-7)
+	intValue = protowire.AppendVarint(intValue, uint64(negative))
+	doubleValue = protowire.AppendTag(doubleValue, 4, protowire.Fixed64Type)
+	doubleValue = protowire.AppendFixed64(doubleValue, math.Float64bits(637.704))
+	array := otlpField(nil, 5, otlpField(otlpField(nil, 1, otlpStringValue("many")), 1, otlpStringValue("values")))
+	kvlist := otlpField(nil, 6, otlpField(nil, 1, otlpKV("some.map.key", otlpStringValue("some value"))))
+
+	r = otlpField(r, 6, otlpKV("string.attribute", otlpStringValue("some string")))
+	r = otlpField(r, 6, otlpKV("boolean.attribute", boolValue))
+	r = otlpField(r, 6, otlpKV("int.attribute", intValue))
+	r = otlpField(r, 6, otlpKV("double.attribute", doubleValue))
+	r = otlpField(r, 6, otlpKV("array.attribute", array))
+	r = otlpField(r, 6, otlpKV("map.attribute", kvlist))
+	r = otlpField(r, 9, []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c})
+	r = otlpField(r, 10, []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74})
+	r = protowire.AppendTag(r, 11, protowire.Fixed64Type)
+	r = protowire.AppendFixed64(r, 1544712661000000000)
+	r = protowire.AppendTag(r, 12, protowire.VarintType) // flags, ignored
+	r = protowire.AppendVarint(r, 1)
+	return r
+}
+
+func TestDecodeOTLPProto(t *testing.T) {
+	received := time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	var bytesBody []byte
+	bytesBody = otlpField(bytesBody, 5, otlpField(nil, 7, []byte("hello")))
+	var observedOnly []byte
+	observedOnly = protowire.AppendTag(observedOnly, 11, protowire.Fixed64Type)
+	observedOnly = protowire.AppendFixed64(observedOnly, 1544712662000000000)
+
+	body := otlpProtoRequest([][]byte{otlpKV("service.name", otlpStringValue("my.service"))},
+		otlpProtoRecord(), bytesBody, observedOnly)
+
+	resourceLogs, err := decodeOTLPProto(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkOTLPEntries(t, otlpEntries(resourceLogs, received), []sources.Entry{
+		{
+			Timestamp: time.Unix(0, 1544712660300000000),
+			Line:      "Example log record",
+			Labels: map[string]string{
+				"service_name":      "my.service",
+				"string_attribute":  "some string",
+				"boolean_attribute": "true",
+				"int_attribute":     "-7",
+				"double_attribute":  "637.704",
+				"array_attribute":   `["many","values"]`,
+				"map_attribute":     `{"some.map.key":"some value"}`,
+				"severity":          "info",
+			},
+			Metadata: map[string]string{"trace_id": "5b8efff798038103d269b633813fc60c", "span_id": "eee19b7ec3c1b174"},
+		},
+		{
+			Timestamp: received,
+			Line:      "aGVsbG8=",
+			Labels:    map[string]string{"service_name": "my.service"},
+			Metadata:  map[string]string{},
+		},
+		{
+			Timestamp: time.Unix(0, 1544712662000000000),
+			Line:      "",
+			Labels:    map[string]string{"service_name": "my.service"},
+			Metadata:  map[string]string{},
+		},
+	})
+}
+
+func TestDecodeOTLPProtoInvalid(t *testing.T) {
+	valid := otlpProtoRequest([][]byte{otlpKV("service.name", otlpStringValue("my.service"))}, otlpProtoRecord())
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"truncated request", valid[:len(valid)-5]},
+		{"truncated length", valid[:1]},
+		{"invalid tag", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"length beyond the message", []byte{0x0a, 0x7f, 0x0a}},
+		{"truncated resource", otlpField(nil, 1, otlpField(nil, 1, []byte{0x0a, 0x05, 'a'}))},
+		{"truncated record", otlpProtoRequest(nil, []byte{0x09, 0x01, 0x02})},
+		{"truncated body", otlpProtoRequest(nil, otlpField(nil, 5, []byte{0x0a, 0x10, 'a'}))},
+		{"truncated attribute", otlpProtoRequest(nil, otlpField(nil, 6, []byte{0x12, 0x03, 0x0a}))},
+		{"truncated array", otlpProtoRequest(nil, otlpField(nil, 5, otlpField(nil, 5, []byte{0x0a, 0x02, 0x0a})))},
+		{"truncated map", otlpProtoRequest(nil, otlpField(nil, 5, otlpField(nil, 6, []byte{0x0a, 0x04, 0x0a, 0x09})))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resourceLogs, err := decodeOTLPProto(tt.body); err == nil {
+				t.Errorf("decoded %d resource logs, want an error", len(resourceLogs))
+			}
+		})
+	}
+}
+
+func FuzzDecodeOTLPProto(f *testing.F) {
+	f.Add(otlpProtoRequest([][]byte{otlpKV("service.name", otlpStringValue("my.service"))}, otlpProtoRecord()))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, body []byte) {
+		resourceLogs, err := decodeOTLPProto(body)
+		if err == nil {
+			otlpEntries(resourceLogs, time.Now()) // must not panic on any input
+		}
+	})
+}
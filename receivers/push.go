@@ -0,0 +1,284 @@
+package receivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/live-labs/lokiactor/config"
+	"github.com/live-labs/lokiactor/loki"
+	"github.com/live-labs/lokiactor/selector"
+	"github.com/live-labs/lokiactor/sources"
+	"google.golang.org/protobuf/encoding/protowire"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KindPush is the receiver kind of lines pushed with the Loki push API.
+const KindPush = config.SourcePush
+
+// Push accepts lines on the Loki push API, so Promtail or Alloy can send to
+// loki-actor as a second client.
+type Push struct {
+	listen string
+	hub    *sources.Hub
+}
+
+func NewPush(cfg config.PushReceiver, hub *sources.Hub) *Push {
+	return &Push{
+		listen: cfg.Listen,
+		hub:    hub,
+	}
+}
+
+// Run serves the push API until ctx is done.
+func (p *Push) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /loki/api/v1/push", p.handlePush)
+	mux.HandleFunc("GET /ready", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return serveHTTP(ctx, KindPush, p.listen, mux)
+}
+
+func (p *Push) handlePush(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var entries []sources.Entry
+	switch contentType {
+	case "application/json":
+		entries, err = decodePushJSON(body)
+	case "", "application/x-protobuf":
+		entries, err = decodePushProto(body)
+	default:
+		err = fmt.Errorf("unsupported content type %s", contentType)
+	}
+	if err != nil {
+		slog.Warn("Rejected push request", "remote", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := p.hub.Publish(r.Context(), KindPush, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodePushJSON(body []byte) ([]sources.Entry, error) {
+	var req struct {
+		Streams []loki.Stream `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid push request: %w", err)
+	}
+
+	var entries []sources.Entry
+	for _, stream := range req.Streams {
+		for _, value := range stream.Values {
+			ns, err := strconv.ParseInt(value.Timestamp, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %q: %w", value.Timestamp, err)
+			}
+			entries = append(entries, sources.Entry{
+				Timestamp: time.Unix(0, ns),
+				Line:      value.Line,
+				Labels:    stream.Details,
+				Metadata:  value.Metadata,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// decodePushProto decodes a snappy compressed logproto.PushRequest.
+func decodePushProto(body []byte) ([]sources.Entry, error) {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %w", err)
+	}
+
+	var entries []sources.Entry
+
+	// PushRequest { repeated StreamAdapter streams = 1; }
+	err = walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		streamEntries, err := decodeStream(v)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, streamEntries...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid push request: %w", err)
+	}
+	return entries, nil
+}
+
+// decodeStream decodes StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+func decodeStream(data []byte) ([]sources.Entry, error) {
+	var labels map[string]string
+	var entries []sources.Entry
+
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			l, err := selector.ParseLabels(string(v))
+			if err != nil {
+				return err
+			}
+			labels = l
+		case 2:
+			e, err := decodeEntry(v)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		entries[i].Labels = labels
+	}
+	return entries, nil
+}
+
+// decodeEntry decodes EntryAdapter { Timestamp timestamp = 1; string line = 2;
+// repeated LabelPairAdapter structuredMetadata = 3; }
+func decodeEntry(data []byte) (sources.Entry, error) {
+	var e sources.Entry
+
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			ts, err := decodeTimestamp(v)
+			if err != nil {
+				return err
+			}
+			e.Timestamp = ts
+		case 2:
+			e.Line = string(v)
+		case 3:
+			name, value, err := decodeLabelPair(v)
+			if err != nil {
+				return err
+			}
+			if e.Metadata == nil {
+				e.Metadata = make(map[string]string)
+			}
+			e.Metadata[name] = value
+		}
+		return nil
+	})
+	return e, err
+}
+
+// decodeTimestamp decodes google.protobuf.Timestamp { int64 seconds = 1; int32 nanos = 2; }
+func decodeTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.VarintType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return time.Time{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		v, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch num {
+		case 1:
+			seconds = int64(v)
+		case 2:
+			nanos = int64(int32(v))
+		}
+	}
+	return time.Unix(seconds, nanos), nil
+}
+
+// decodeLabelPair decodes LabelPairAdapter { string name = 1; string value = 2; }
+func decodeLabelPair(data []byte) (string, string, error) {
+	var name, value string
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			name = string(v)
+		case 2:
+			value = string(v)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+// walkFields calls fn for every field of a protobuf message. fn gets the content of length
+// delimited fields, and the raw encoding of the other fields, to read with the protowire.Consume functions.
+func walkFields(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			if err := fn(num, typ, v); err != nil {
+				return err
+			}
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		v := data[:n]
+		data = data[n:]
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package receivers
+
+import (
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"maps"
+	"testing"
+	"time"
+)
+
+// protoEntry encodes a logproto.EntryAdapter, as Promtail sends it.
+func protoEntry(ts time.Time, line string, metadata ...[2]string) []byte {
+	var stamp []byte
+	stamp = protowire.AppendTag(stamp, 1, protowire.VarintType)
+	stamp = protowire.AppendVarint(stamp, uint64(ts.Unix()))
+	stamp = protowire.AppendTag(stamp, 2, protowire.VarintType)
+	stamp = protowire.AppendVarint(stamp, uint64(ts.Nanosecond()))
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, stamp)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, line)
+	for _, pair := range metadata {
+		var p []byte
+		p = protowire.AppendTag(p, 1, protowire.BytesType)
+		p = protowire.AppendString(p, pair[0])
+		p = protowire.AppendTag(p, 2, protowire.BytesType)
+		p = protowire.AppendString(p, pair[1])
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, p)
+	}
+	return b
+}
+
+// protoStream encodes a logproto.StreamAdapter.
+func protoStream(labels string, entries ...[]byte) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, labels)
+	for _, e := range entries {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, e)
+	}
+	// Promtail sets the hash of the labels, field 3, which is ignored
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1234567)
+	return b
+}
+
+// protoPush encodes a snappy compressed logproto.PushRequest.
+func protoPush(streams ...[]byte) []byte {
+	var b []byte
+	for _, s := range streams {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	return snappy.Encode(nil, b)
+}
+
+func TestDecodePushProto(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 678, time.UTC)
+
+	body := protoPush(
+		protoStream(`{job="varlogs", filename="/var/log/syslog"}`,
+			protoEntry(ts, "first line"),
+			protoEntry(ts.Add(time.Second), "second line", [2]string{"trace_id", "abc"}),
+		),
+		protoStream(`{job="nginx"}`, protoEntry(ts, `GET / 200`)),
+	)
+
+	entries, err := decodePushProto(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	want := []struct {
+		ts       time.Time
+		line     string
+		labels   map[string]string
+		metadata map[string]string
+	}{
+		{ts, "first line", map[string]string{"job": "varlogs", "filename": "/var/log/syslog"}, nil},
+		{ts.Add(time.Second), "second line", map[string]string{"job": "varlogs", "filename": "/var/log/syslog"}, map[string]string{"trace_id": "abc"}},
+		{ts, "GET / 200", map[string]string{"job": "nginx"}, nil},
+	}
+	for i, w := range want {
+		e := entries[i]
+		if !e.Timestamp.Equal(w.ts) || e.Line != w.line || !maps.Equal(e.Labels, w.labels) || !maps.Equal(e.Metadata, w.metadata) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func TestDecodePushProtoInvalid(t *testing.T) {
+	valid := protoPush(protoStream(`{job="varlogs"}`, protoEntry(time.Unix(1, 0), "line")))
+	raw, _ := snappy.Decode(nil, valid)
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"not snappy", []byte("plain text body")},
+		{"truncated snappy", valid[:len(valid)-3]},
+		{"truncated message", snappy.Encode(nil, raw[:len(raw)-4])},
+		{"invalid tag", snappy.Encode(nil, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})},
+		{"invalid labels", protoPush(protoStream(`job="varlogs"`, protoEntry(time.Unix(1, 0), "line")))},
+		{"unterminated labels", protoPush(protoStream(`{job="varlogs`, protoEntry(time.Unix(1, 0), "line")))},
+		{"truncated timestamp", protoPush(protoStream(`{job="varlogs"}`, []byte{0x0a, 0x02, 0x08, 0x80}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if entries, err := decodePushProto(tt.body); err == nil {
+				t.Errorf("decoded %d entries, want an error", len(entries))
+			}
+		})
+	}
+}
+
+func TestDecodePushJSON(t *testing.T) {
+	body := `{"streams": [
+		{"stream": {"job": "varlogs"}, "values": [
+			["1735787045000000678", "first line"],
+			["1735787046000000000", "second line", {"trace_id": "abc"}]
+		]},
+		{"stream": {"job": "nginx"}, "values": [["1735787045000000000", "GET / 200"]]}
+	]}`
+
+	entries, err := decodePushJSON([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if !entries[0].Timestamp.Equal(time.Unix(0, 1735787045000000678)) || entries[0].Line != "first line" || entries[0].Labels["job"] != "varlogs" {
+		t.Errorf("entry 0 = %+v", entries[0])
+	}
+	if entries[1].Metadata["trace_id"] != "abc" {
+		t.Errorf("entry 1 metadata = %v", entries[1].Metadata)
+	}
+	if entries[2].Labels["job"] != "nginx" {
+		t.Errorf("entry 2 labels = %v", entries[2].Labels)
+	}
+}
+
+func TestDecodePushJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"truncated", `{"streams": [{"stream": {"job": "varlogs"}, "values": [["1735787045000000000", "li`},
+		{"not json", `streams`},
+		{"timestamp not a number", `{"streams": [{"stream": {}, "values": [["yesterday", "line"]]}]}`},
+		{"timestamp as number", `{"streams": [{"stream": {}, "values": [[1735787045000000000, "line"]]}]}`},
+		{"missing line", `{"streams": [{"stream": {}, "values": [["1735787045000000000"]]}]}`},
+		{"too many elements", `{"streams": [{"stream": {}, "values": [["1", "line", {}, "extra"]]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if entries, err := decodePushJSON([]byte(tt.body)); err == nil {
+				t.Errorf("decoded %d entries, want an error", len(entries))
+			}
+		})
+	}
+}
+
+func FuzzDecodePushProto(f *testing.F) {
+	f.Add(protoPush(protoStream(`{job="varlogs"}`, protoEntry(time.Unix(1, 0), "line", [2]string{"k", "v"}))))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, body []byte) {
+		decodePushProto(body)                     // must not panic on any input
+		decodePushProto(snappy.Encode(nil, body)) // nor on any decompressed message
+	})
+}
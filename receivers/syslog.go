@@ -0,0 +1,215 @@
+package receivers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/config"
+	"github.com/live-labs/lokiactor/sources"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KindSyslog is the receiver kind of syslog messages.
+const KindSyslog = config.SourceSyslog
+
+const maxSyslogSize = 64 << 10
+
+// errSyslogTooLarge is returned for a newline framed message longer than maxSyslogSize,
+// its content is discarded and the next message can be read.
+var errSyslogTooLarge = errors.New("syslog message too large")
+
+// Syslog receives syslog messages (RFC 5424 and RFC 3164) over UDP and TCP, for
+// devices that can't ship their logs to Loki.
+type Syslog struct {
+	udp string
+	tcp string
+	hub *sources.Hub
+}
+
+func NewSyslog(cfg config.SyslogReceiver, hub *sources.Hub) *Syslog {
+	return &Syslog{
+		udp: cfg.UDP,
+		tcp: cfg.TCP,
+		hub: hub,
+	}
+}
+
+// Run receives messages on the configured listeners until ctx is done.
+func (s *Syslog) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+
+	if s.udp != "" {
+		conn, err := net.ListenPacket("udp", s.udp)
+		if err != nil {
+			return fmt.Errorf("failed to listen on udp %s: %w", s.udp, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.serveUDP(ctx, conn)
+		}()
+	}
+
+	if s.tcp != "" {
+		ln, err := net.Listen("tcp", s.tcp)
+		if err != nil {
+			return fmt.Errorf("failed to listen on tcp %s: %w", s.tcp, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.serveTCP(ctx, ln)
+		}()
+	}
+
+	slog.Info("Receiver listening", "receiver", KindSyslog, "udp", s.udp, "tcp", s.tcp)
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs: // a listener failed, stop the other one too
+	}
+	cancel()
+	wg.Wait()
+	return err
+}
+
+func (s *Syslog) serveUDP(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxSyslogSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read syslog datagram: %w", err)
+		}
+		s.publish(ctx, string(buf[:n]), addr)
+	}
+}
+
+func (s *Syslog) serveTCP(ctx context.Context, ln net.Listener) error {
+	var conns sync.WaitGroup
+	defer conns.Wait()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept syslog connection: %w", err)
+		}
+
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			s.handleConn(ctx, conn)
+		}()
+	}
+}
+
+// handleConn reads the messages of a TCP connection, framed by octet counting or by newlines (RFC 6587).
+func (s *Syslog) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	r := bufio.NewReaderSize(conn, maxSyslogSize)
+	for {
+		msg, err := readFrame(r)
+		if msg != "" {
+			s.publish(ctx, msg, conn.RemoteAddr())
+		}
+		if errors.Is(err, errSyslogTooLarge) {
+			slog.Warn("Dropped syslog message", "remote", conn.RemoteAddr(), "error", err)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				slog.Warn("Closing syslog connection", "remote", conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+	}
+}
+
+// readFrame reads the next message of a syslog stream. The buffer of r bounds the size of
+// the messages, its size must be maxSyslogSize.
+func readFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if b[0] < '0' || b[0] > '9' {
+		// non-transparent framing, the message ends at the newline
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// skip the rest of the message without buffering it
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = r.ReadSlice('\n')
+			}
+			if err != nil {
+				return "", err
+			}
+			return "", errSyslogTooLarge
+		}
+		return strings.TrimRight(string(line), "\r\n\x00"), err
+	}
+
+	// octet counting: MSG-LEN SP SYSLOG-MSG
+	prefix, err := r.ReadSlice(' ')
+	length := string(prefix)
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("invalid syslog frame length %q", length[:16])
+	}
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil || n <= 0 || n > maxSyslogSize {
+		return "", fmt.Errorf("invalid syslog frame length %q", length)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(msg), "\r\n\x00"), nil
+}
+
+func (s *Syslog) publish(ctx context.Context, msg string, remote net.Addr) {
+	entry, err := parseSyslog(msg, time.Now())
+	if err != nil {
+		slog.Warn("Dropped invalid syslog message", "remote", remote, "error", err)
+		return
+	}
+
+	if err := s.hub.Publish(ctx, KindSyslog, []sources.Entry{entry}); err != nil {
+		slog.Debug("Syslog message not delivered", "error", err)
+	}
+}
@@ -0,0 +1,210 @@
+package receivers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/live-labs/lokiactor/sources"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// parseSyslog parses an RFC 5424 or RFC 3164 message. The hostname, app name, facility and
+// severity become labels, the process and message ids and the structured data become metadata.
+// Messages without a timestamp get the received time.
+func parseSyslog(msg string, received time.Time) (sources.Entry, error) {
+	pri, rest, err := parsePriority(msg)
+	if err != nil {
+		return sources.Entry{}, err
+	}
+
+	var e sources.Entry
+	if strings.HasPrefix(rest, "1 ") {
+		e, err = parseRFC5424(rest[2:], received)
+	} else {
+		e = parseRFC3164(rest, received)
+	}
+	if err != nil {
+		return sources.Entry{}, err
+	}
+
+	e.Labels["facility"] = syslogFacilities[pri/8]
+	e.Labels["severity"] = syslogSeverities[pri%8]
+	for k, v := range e.Labels {
+		if v == "" {
+			delete(e.Labels, k)
+		}
+	}
+	return e, nil
+}
+
+// parsePriority parses the <PRI> prefix of a message.
+func parsePriority(msg string) (int, string, error) {
+	if !strings.HasPrefix(msg, "<") {
+		return 0, "", errors.New("missing priority")
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errors.New("invalid priority")
+	}
+	pri, err := strconv.Atoi(msg[1:end])
+	if err != nil || pri < 0 || pri >= len(syslogFacilities)*8 {
+		return 0, "", fmt.Errorf("invalid priority %q", msg[1:end])
+	}
+	return pri, msg[end+1:], nil
+}
+
+// parseRFC5424 parses TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG],
+// following the version.
+func parseRFC5424(s string, received time.Time) (sources.Entry, error) {
+	fields := make([]string, 5)
+	for i := range fields {
+		field, rest, _ := strings.Cut(s, " ")
+		if field == "-" {
+			field = ""
+		}
+		fields[i], s = field, rest
+	}
+
+	ts := received
+	if fields[0] != "" {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return sources.Entry{}, fmt.Errorf("invalid timestamp %q", fields[0])
+		}
+		ts = t
+	}
+
+	metadata := map[string]string{}
+	if fields[3] != "" {
+		metadata["procid"] = fields[3]
+	}
+	if fields[4] != "" {
+		metadata["msgid"] = fields[4]
+	}
+
+	s, err := parseStructuredData(s, metadata)
+	if err != nil {
+		return sources.Entry{}, err
+	}
+
+	return sources.Entry{
+		Timestamp: ts,
+		Line:      strings.TrimPrefix(strings.TrimPrefix(s, " "), "\ufeff"),
+		Labels: map[string]string{
+			"hostname": fields[1],
+			"app_name": fields[2],
+		},
+		Metadata: metadata,
+	}, nil
+}
+
+// parseStructuredData parses the structured data elements into metadata keyed by
+// SD-ID.PARAM-NAME, returning the rest of the message.
+func parseStructuredData(s string, metadata map[string]string) (string, error) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], nil
+	}
+
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return "", errors.New("unterminated structured data")
+		}
+		id := s[1:end]
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			eq := strings.Index(s, `="`)
+			if eq < 0 {
+				return "", fmt.Errorf("invalid structured data parameter of %s", id)
+			}
+			name := s[1:eq]
+			s = s[eq+2:]
+
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if s[i] == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if !closed {
+				return "", fmt.Errorf("unterminated structured data parameter %s of %s", name, id)
+			}
+			metadata[id+"."+name] = value.String()
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return "", fmt.Errorf("unterminated structured data element %s", id)
+		}
+		s = s[1:]
+	}
+	return s, nil
+}
+
+// parseRFC3164 parses the loosely defined BSD format, TIMESTAMP HOSTNAME TAG[PID]: MSG.
+// Senders often leave out the hostname or even the timestamp.
+func parseRFC3164(s string, received time.Time) sources.Entry {
+	ts := received
+	if len(s) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], received.Location()); err == nil {
+			// the year is not sent, take the one closest to the received time
+			ts = t.AddDate(received.Year(), 0, 0)
+			if ts.After(received.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+		}
+	}
+
+	labels := map[string]string{}
+	metadata := map[string]string{}
+
+	// the hostname is followed by the tag, which ends with a colon or a [PID]
+	if host, rest, ok := strings.Cut(s, " "); ok && !isSyslogTag(host) {
+		if tag, _, _ := strings.Cut(rest, " "); isSyslogTag(tag) {
+			labels["hostname"] = host
+			s = rest
+		}
+	}
+
+	if tag, rest, ok := strings.Cut(s, " "); ok && isSyslogTag(tag) {
+		tag = strings.TrimSuffix(tag, ":")
+		if name, pid, ok := strings.Cut(tag, "["); ok {
+			tag = name
+			metadata["procid"] = strings.TrimSuffix(pid, "]")
+		}
+		labels["app_name"] = tag
+		s = rest
+	}
+
+	return sources.Entry{
+		Timestamp: ts,
+		Line:      s,
+		Labels:    labels,
+		Metadata:  metadata,
+	}
+}
+
+func isSyslogTag(s string) bool {
+	return strings.HasSuffix(s, ":") || strings.HasSuffix(s, "]") && strings.Contains(s, "[")
+}
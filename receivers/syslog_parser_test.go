@@ -0,0 +1,255 @@
+package receivers
+
+import (
+	"bufio"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	received := time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		msg      string
+		ts       time.Time
+		line     string
+		labels   map[string]string
+		metadata map[string]string
+	}{
+		{
+			name: "rfc 5424 example",
+			msg:  `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - BOM'su root' failed for lonvick on /dev/pts/8`,
+			ts:   time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+			line: `BOM'su root' failed for lonvick on /dev/pts/8`,
+			labels: map[string]string{
+				"hostname": "mymachine.example.com", "app_name": "su", "facility": "auth", "severity": "crit",
+			},
+			metadata: map[string]string{"msgid": "ID47"},
+		},
+		{
+			name: "rfc 5424 structured data",
+			msg:  `<165>1 2003-10-11T22:14:15.003-07:00 mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"] An application event log entry...`,
+			ts:   time.Date(2003, 10, 12, 5, 14, 15, 3000000, time.UTC),
+			line: "An application event log entry...",
+			labels: map[string]string{
+				"hostname": "mymachine.example.com", "app_name": "evntslog", "facility": "local4", "severity": "notice",
+			},
+			metadata: map[string]string{
+				"procid": "1234", "msgid": "ID47",
+				"exampleSDID@32473.iut": "3", "exampleSDID@32473.eventSource": "Application", "exampleSDID@32473.eventID": "1011",
+				"examplePriority@32473.class": "high",
+			},
+		},
+		{
+			name: "rfc 5424 escaped structured data and BOM",
+			msg:  "<14>1 2025-03-04T09:59:59Z host app - - [meta path=\"C:\\\\logs\\]\" note=\"say \\\"hi\\\"\"] \ufeffhello",
+			ts:   time.Date(2025, 3, 4, 9, 59, 59, 0, time.UTC),
+			line: "hello",
+			labels: map[string]string{
+				"hostname": "host", "app_name": "app", "facility": "user", "severity": "info",
+			},
+			metadata: map[string]string{"meta.path": `C:\logs]`, "meta.note": `say "hi"`},
+		},
+		{
+			name:     "rfc 5424 nil values",
+			msg:      `<13>1 - - - - - -`,
+			ts:       received,
+			line:     "",
+			labels:   map[string]string{"facility": "user", "severity": "notice"},
+			metadata: map[string]string{},
+		},
+		{
+			name: "rsyslog rfc 3164",
+			msg:  `<86>Mar  4 09:58:01 web01 sshd[4242]: Accepted publickey for deploy from 10.0.0.5 port 51234 ssh2`,
+			ts:   time.Date(2025, 3, 4, 9, 58, 1, 0, time.UTC),
+			line: "Accepted publickey for deploy from 10.0.0.5 port 51234 ssh2",
+			labels: map[string]string{
+				"hostname": "web01", "app_name": "sshd", "facility": "authpriv", "severity": "info",
+			},
+			metadata: map[string]string{"procid": "4242"},
+		},
+		{
+			name: "rfc 3164 without hostname",
+			msg:  `<13>Mar  4 09:58:01 kernel: eth0: link down`,
+			ts:   time.Date(2025, 3, 4, 9, 58, 1, 0, time.UTC),
+			line: "eth0: link down",
+			labels: map[string]string{
+				"app_name": "kernel", "facility": "user", "severity": "notice",
+			},
+			metadata: map[string]string{},
+		},
+		{
+			name:     "cisco message without timestamp",
+			msg:      `<187>%LINK-3-UPDOWN: Interface GigabitEthernet0/1, changed state to down`,
+			ts:       received,
+			line:     "Interface GigabitEthernet0/1, changed state to down",
+			labels:   map[string]string{"app_name": "%LINK-3-UPDOWN", "facility": "local7", "severity": "err"},
+			metadata: map[string]string{},
+		},
+		{
+			name: "rfc 3164 of last year",
+			msg:  `<14>Dec 31 23:59:59 host app: happy new year`,
+			ts:   time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+			line: "happy new year",
+			labels: map[string]string{
+				"hostname": "host", "app_name": "app", "facility": "user", "severity": "info",
+			},
+			metadata: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseSyslog(tt.msg, received)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !e.Timestamp.Equal(tt.ts) {
+				t.Errorf("timestamp = %s, want %s", e.Timestamp, tt.ts)
+			}
+			if e.Line != tt.line {
+				t.Errorf("line = %q, want %q", e.Line, tt.line)
+			}
+			if !maps.Equal(e.Labels, tt.labels) {
+				t.Errorf("labels = %v, want %v", e.Labels, tt.labels)
+			}
+			if !maps.Equal(e.Metadata, tt.metadata) {
+				t.Errorf("metadata = %v, want %v", e.Metadata, tt.metadata)
+			}
+		})
+	}
+}
+
+func TestParseSyslogInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"empty", ""},
+		{"missing priority", "Mar  4 09:58:01 host app: message"},
+		{"unterminated priority", "<34"},
+		{"empty priority", "<>1 - - - - - -"},
+		{"priority too long", "<1234>message"},
+		{"priority out of range", "<192>message"},
+		{"priority not a number", "<ab>message"},
+		{"invalid timestamp", "<34>1 yesterday host app - - - message"},
+		{"truncated structured data", `<34>1 - host app - - [id`},
+		{"unterminated structured data", `<34>1 - host app - - [id a="b" message`},
+		{"unterminated parameter", `<34>1 - host app - - [id a="b] message`},
+		{"parameter without value", `<34>1 - host app - - [id a] message`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if e, err := parseSyslog(tt.msg, time.Now()); err == nil {
+				t.Errorf("parsed %+v, want an error", e)
+			}
+		})
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	long := "<13>" + strings.Repeat("x", maxSyslogSize)
+
+	tests := []struct {
+		name    string
+		stream  string
+		want    []string
+		dropped int
+		err     string
+	}{
+		{
+			name:   "newline framing",
+			stream: "<13>Mar  4 09:58:01 host app: one\n<13>Mar  4 09:58:02 host app: two\r\n",
+			want:   []string{"<13>Mar  4 09:58:01 host app: one", "<13>Mar  4 09:58:02 host app: two"},
+			err:    "EOF",
+		},
+		{
+			name:   "octet counting",
+			stream: "11 <13>1 - - -12 <14>1 a b c\n",
+			want:   []string{"<13>1 - - -", "<14>1 a b c"},
+			err:    "EOF",
+		},
+		{
+			name:   "last message without newline",
+			stream: "<13>one\n<13>two",
+			want:   []string{"<13>one", "<13>two"},
+			err:    "EOF",
+		},
+		{
+			name:    "message over the maximum size",
+			stream:  long + "\n<13>next\n",
+			want:    []string{"<13>next"},
+			dropped: 1,
+			err:     "EOF",
+		},
+		{
+			name:   "truncated octet counted frame",
+			stream: "11 <13>1 - - -20 <13>1 short",
+			want:   []string{"<13>1 - - -"},
+			err:    "unexpected EOF",
+		},
+		{
+			name:   "invalid frame length",
+			stream: "12a <13>message\n",
+			err:    "invalid syslog frame length",
+		},
+		{
+			name:   "frame length over the maximum size",
+			stream: "99999999 <13>message\n",
+			err:    "invalid syslog frame length",
+		},
+		{
+			name:   "frame length without end",
+			stream: strings.Repeat("1", maxSyslogSize+10),
+			err:    "invalid syslog frame length",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tt.stream), maxSyslogSize)
+
+			// read like handleConn does
+			var got []string
+			var dropped int
+			var err error
+			for {
+				var msg string
+				msg, err = readFrame(r)
+				if msg != "" {
+					got = append(got, msg)
+				}
+				if errors.Is(err, errSyslogTooLarge) {
+					dropped++
+					continue
+				}
+				if err != nil {
+					break
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped %d messages, want %d", dropped, tt.dropped)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func FuzzParseSyslog(f *testing.F) {
+	f.Add(`<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 [a b="c"] message`)
+	f.Add(`<86>Mar  4 09:58:01 web01 sshd[4242]: message`)
+	f.Fuzz(func(t *testing.T, msg string) {
+		parseSyslog(msg, time.Now()) // must not panic on any input
+	})
+}
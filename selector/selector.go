@@ -0,0 +1,215 @@
+package selector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Op is a label matching operator of a LogQL stream selector.
+type Op string
+
+const (
+	OpEqual    Op = "="
+	OpNotEqual Op = "!="
+	OpRegex    Op = "=~"
+	OpNotRegex Op = "!~"
+)
+
+// Matcher matches a single label.
+type Matcher struct {
+	Name  string
+	Op    Op
+	Value string
+	re    *regexp.Regexp
+}
+
+func (m Matcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name] // a missing label matches as an empty value, like in LogQL
+	switch m.Op {
+	case OpEqual:
+		return v == m.Value
+	case OpNotEqual:
+		return v != m.Value
+	case OpRegex:
+		return m.re.MatchString(v)
+	case OpNotRegex:
+		return !m.re.MatchString(v)
+	default:
+		return false
+	}
+}
+
+// Selector is a LogQL stream selector such as {app="api", level=~"error|warn"}.
+// A line matches if all of the matchers match its labels.
+type Selector []Matcher
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, m := range s {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, m := range s {
+		parts[i] = m.Name + string(m.Op) + strconv.Quote(m.Value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// Parse parses a stream selector. An empty string or {} selects all lines.
+func Parse(s string) (Selector, error) {
+	p := parser{s: strings.TrimSpace(s)}
+	if p.s == "" {
+		return Selector{}, nil
+	}
+
+	var sel Selector
+
+	if !p.consume("{") {
+		return nil, fmt.Errorf("selector %q must start with {", s)
+	}
+	for {
+		p.skipSpace()
+		if p.consume("}") {
+			break
+		}
+		if len(sel) > 0 {
+			if !p.consume(",") {
+				return nil, fmt.Errorf("selector %q: expected , at position %d", s, p.pos)
+			}
+			p.skipSpace()
+		}
+
+		name := p.name()
+		if name == "" {
+			return nil, fmt.Errorf("selector %q: expected label name at position %d", s, p.pos)
+		}
+		p.skipSpace()
+
+		var op Op
+		for _, o := range []Op{OpRegex, OpNotRegex, OpNotEqual, OpEqual} {
+			if p.consume(string(o)) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("selector %q: expected operator at position %d", s, p.pos)
+		}
+		p.skipSpace()
+
+		value, err := p.quoted()
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %w", s, err)
+		}
+
+		m := Matcher{Name: name, Op: op, Value: value}
+		if op == OpRegex || op == OpNotRegex {
+			// like Prometheus, regular expressions are anchored at both ends
+			m.re, err = regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("selector %q: %w", s, err)
+			}
+		}
+		sel = append(sel, m)
+	}
+
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("selector %q: unexpected %q after }", s, p.s[p.pos:])
+	}
+
+	return sel, nil
+}
+
+// ParseLabels parses a label set in the Prometheus text form {a="b", c="d"}.
+func ParseLabels(s string) (map[string]string, error) {
+	sel, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(sel))
+	for _, m := range sel {
+		if m.Op != OpEqual {
+			return nil, fmt.Errorf("labels %q: unexpected operator %s", s, m.Op)
+		}
+		labels[m.Name] = m.Value
+	}
+	return labels, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(token string) bool {
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *parser) name() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || p.pos > start && c >= '0' && c <= '9' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.s[start:p.pos]
+}
+
+// quoted reads a double quoted or backtick quoted string.
+func (p *parser) quoted() (string, error) {
+	if p.pos >= len(p.s) {
+		return "", fmt.Errorf("expected quoted value at position %d", p.pos)
+	}
+
+	if p.s[p.pos] == '`' {
+		end := strings.IndexByte(p.s[p.pos+1:], '`')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated value at position %d", p.pos)
+		}
+		v := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return v, nil
+	}
+
+	if p.s[p.pos] != '"' {
+		return "", fmt.Errorf("expected quoted value at position %d", p.pos)
+	}
+
+	// find the closing quote, skipping escaped characters
+	for i := p.pos + 1; i < len(p.s); i++ {
+		switch p.s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(p.s[p.pos : i+1])
+			if err != nil {
+				return "", fmt.Errorf("invalid value at position %d: %w", p.pos, err)
+			}
+			p.pos = i + 1
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated value at position %d", p.pos)
+}
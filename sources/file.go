@@ -0,0 +1,174 @@
+package sources
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+const filePollInterval = 500 * time.Millisecond
+
+// File follows a local log file like tail -F, reopening it when it's rotated or truncated.
+type File struct {
+	name      string // used in logs, usually the flow name
+	path      string
+	fromStart bool // read the existing content of the file, not only new lines
+	labels    map[string]string
+	state     stateHolder
+}
+
+// NewFile creates a file source. Lines get the static labels, plus a filename label
+// unless the labels already have one.
+func NewFile(name, path string, fromStart bool, labels map[string]string) *File {
+	l := make(map[string]string, len(labels)+1)
+	l["filename"] = path
+	for k, v := range labels {
+		l[k] = v
+	}
+
+	return &File{
+		name:      name,
+		path:      path,
+		fromStart: fromStart,
+		labels:    l,
+	}
+}
+
+func (s *File) State() State {
+	return s.state.get()
+}
+
+func (s *File) Run(ctx context.Context, sink Sink) {
+	defer s.state.set(s.name, StateStopped, nil)
+
+	seekEnd := !s.fromStart // only skip existing lines of the file present at startup
+
+	for {
+		file, err := os.Open(s.path)
+		if err != nil {
+			seekEnd = false // the file is created after startup, all its lines are new
+			if s.state.get().State != StateBackoff {
+				slog.Error("Failed to open log file, waiting for it", "flow", s.name, "file", s.path, "error", err)
+			}
+			s.state.set(s.name, StateBackoff, err)
+			if !sleep(ctx, filePollInterval) {
+				return
+			}
+			continue
+		}
+
+		if seekEnd {
+			if _, err := file.Seek(0, io.SeekEnd); err != nil {
+				slog.Error("Failed to seek to the end of log file", "flow", s.name, "file", s.path, "error", err)
+			}
+		}
+		seekEnd = false
+
+		s.state.set(s.name, StateConnected, nil)
+		slog.Info("Following log file", "flow", s.name, "file", s.path)
+
+		err = s.follow(ctx, file, sink)
+		file.Close()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.state.set(s.name, StateBackoff, err)
+			slog.Error("Failed to read log file", "flow", s.name, "file", s.path, "error", err)
+			if !sleep(ctx, filePollInterval) {
+				return
+			}
+		}
+	}
+}
+
+// follow reads lines from the file until it's rotated, returning nil so it's reopened.
+func (s *File) follow(ctx context.Context, file *os.File, sink Sink) error {
+	r := bufio.NewReader(file)
+	partial := ""
+	var offset int64
+
+	if pos, err := file.Seek(0, io.SeekCurrent); err == nil {
+		offset = pos
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		offset += int64(len(line))
+
+		if err == nil {
+			sink.ProcessEntry(newLineEntry(partial+line, s.labels))
+			partial = ""
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		// keep an incomplete last line until the writer finishes it
+		partial += line
+
+		if !sleep(ctx, filePollInterval) {
+			return nil
+		}
+
+		current, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		latest, err := os.Stat(s.path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue // rotated away, the new file is not there yet
+			}
+			return err
+		}
+
+		if !os.SameFile(current, latest) {
+			// rotated, read what was still written to the old file before switching
+			rest, _ := io.ReadAll(r)
+			for _, l := range strings.SplitAfter(partial+string(rest), "\n") {
+				if l != "" {
+					sink.ProcessEntry(newLineEntry(l, s.labels))
+				}
+			}
+			slog.Info("Log file rotated, reopening", "flow", s.name, "file", s.path)
+			return nil
+		}
+
+		if latest.Size() < offset {
+			slog.Info("Log file truncated, reading from the beginning", "flow", s.name, "file", s.path)
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			r.Reset(file)
+			partial = ""
+			offset = 0
+		}
+	}
+}
+
+// newLineEntry creates an entry for a line read now.
+func newLineEntry(line string, labels map[string]string) Entry {
+	return Entry{
+		Timestamp: time.Now(),
+		Line:      strings.TrimRight(line, "\r\n"),
+		Labels:    labels,
+	}
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,124 @@
+package sources
+
+import (
+	"context"
+	"github.com/live-labs/lokiactor/selector"
+	"log/slog"
+	"sync"
+)
+
+const receiverQueueSize = 1000
+
+// Hub routes lines pushed to loki-actor by receivers to the flows reading from that
+// kind of receiver whose label selector matches them.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[*subscription]struct{}
+}
+
+type subscription struct {
+	kind     string
+	selector selector.Selector
+	c        chan Entry
+	done     chan struct{} // closed when the flow stops receiving
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[*subscription]struct{}),
+	}
+}
+
+// Publish delivers the entries received by a kind of receiver to all matching subscribers.
+// It blocks while a subscriber queue is full, pushing back on the sender, until ctx is done
+// or the subscriber stops. The lock is not held while blocked, so flows can stop meanwhile.
+func (h *Hub) Publish(ctx context.Context, kind string, entries []Entry) error {
+	h.mu.RLock()
+	subs := make([]*subscription, 0, len(h.subs))
+	for sub := range h.subs {
+		if sub.kind == kind {
+			subs = append(subs, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, e := range entries {
+		for _, sub := range subs {
+			if !sub.selector.Matches(e.Labels) {
+				continue
+			}
+			select {
+			case sub.c <- e:
+			case <-sub.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Hub) subscribe(kind string, sel selector.Selector) *subscription {
+	sub := &subscription{
+		kind:     kind,
+		selector: sel,
+		c:        make(chan Entry, receiverQueueSize),
+		done:     make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+func (h *Hub) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+
+	close(sub.done)
+}
+
+// Receiver is the source of a flow fed by a hub, with the lines matching its selector.
+type Receiver struct {
+	name     string // used in logs, usually the flow name
+	kind     string // receiver kind, e.g. push
+	hub      *Hub
+	selector selector.Selector
+	state    stateHolder
+}
+
+func NewReceiver(name, kind string, hub *Hub, sel selector.Selector) *Receiver {
+	return &Receiver{
+		name:     name,
+		kind:     kind,
+		hub:      hub,
+		selector: sel,
+	}
+}
+
+func (s *Receiver) State() State {
+	return s.state.get()
+}
+
+func (s *Receiver) Run(ctx context.Context, sink Sink) {
+	defer s.state.set(s.name, StateStopped, nil)
+
+	sub := s.hub.subscribe(s.kind, s.selector)
+	defer s.hub.unsubscribe(sub)
+
+	s.state.set(s.name, StateConnected, nil)
+	slog.Info("Receiving lines", "flow", s.name, "receiver", s.kind, "selector", s.selector.String())
+
+	// the sink is fed from this goroutine only, lines of concurrent senders are serialized here
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-sub.c:
+			sink.ProcessEntry(e)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"github.com/live-labs/lokiactor/backoff"
+	"github.com/live-labs/lokiactor/loki"
+	"log/slog"
+	"time"
+)
+
+// LokiPoll queries Loki with query_range on an interval, for networks where the websocket
+// tail is blocked. Each query reaches back by the overlap to pick up late lines, the sink
+// drops the lines already processed by the previous query.
+type LokiPoll struct {
+	opts     LokiOptions
+	interval time.Duration
+	overlap  time.Duration
+	state    stateHolder
+}
+
+func NewLokiPoll(opts LokiOptions, interval, overlap time.Duration) *LokiPoll {
+	return &LokiPoll{opts: opts, interval: interval, overlap: overlap}
+}
+
+func (s *LokiPoll) State() State {
+	return s.state.get()
+}
+
+func (s *LokiPoll) Run(ctx context.Context, sink Sink) {
+	defer s.state.set(s.opts.Name, StateStopped, nil)
+
+	retry := backoff.New(s.opts.Backoff)
+
+	slog.Info("Polling Loki", "flow", s.opts.Name, "endpoint", s.opts.Endpoint, "interval", s.interval, "overlap", s.overlap)
+
+	// without a position to resume from, the flow starts like the tail: no line before the first
+	// query is processed, the overlap never reaches back further
+	var floor time.Time
+
+	for {
+		end := time.Now()
+		from := end.Add(-s.opts.StartOffset)
+		start := sink.ResumeFrom(from)
+		if floor.IsZero() && start.Equal(from) {
+			floor = from
+		}
+		start = start.Add(-s.overlap)
+		if start.Before(floor) {
+			start = floor
+		}
+
+		s.state.set(s.opts.Name, StateConnecting, nil)
+		n, err := fetchRange(ctx, s.opts, sink, start, end)
+
+		var delay time.Duration
+		var statusErr *loki.StatusError
+
+		switch {
+		case ctx.Err() != nil:
+			return
+
+		case errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+			delay = retry.Capped()
+			s.state.set(s.opts.Name, StateRejected, err)
+			slog.Error("Loki rejected the query, check the query and credentials",
+				"flow", s.opts.Name, "endpoint", s.opts.Endpoint, "status", statusErr.StatusCode, "retry_in", delay, "error", err)
+
+		case err != nil:
+			delay = retry.Next()
+			s.state.set(s.opts.Name, StateBackoff, err)
+			slog.Error("Failed to poll Loki", "flow", s.opts.Name, "endpoint", s.opts.Endpoint, "retry_in", delay, "error", err)
+
+		default:
+			retry.Reset()
+			s.state.set(s.opts.Name, StateConnected, nil)
+			slog.Debug("Polled Loki", "flow", s.opts.Name, "lines", n, "start", start, "end", end)
+
+			// nothing older than the overlap will be queried again, even if no line arrived
+			sink.Settle(end.Add(-s.overlap))
+			delay = s.interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"github.com/live-labs/lokiactor/loki"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const rangePageSize = 5000
+
+// LokiRange reads the lines logged in a fixed time window with query_range, used for backfills.
+type LokiRange struct {
+	opts  LokiOptions
+	start time.Time
+	end   time.Time
+	state stateHolder
+
+	lines int
+	err   error
+}
+
+func NewLokiRange(opts LokiOptions, start, end time.Time) *LokiRange {
+	return &LokiRange{opts: opts, start: start, end: end}
+}
+
+func (s *LokiRange) State() State {
+	return s.state.get()
+}
+
+// Run reads the whole window and returns.
+func (s *LokiRange) Run(ctx context.Context, sink Sink) {
+	s.state.set(s.opts.Name, StateConnected, nil)
+	s.lines, s.err = fetchRange(ctx, s.opts, sink, s.start, s.end)
+	s.state.set(s.opts.Name, StateStopped, s.err)
+}
+
+// Result returns the number of lines read and the error that stopped the last run, if any.
+func (s *LokiRange) Result() (int, error) {
+	return s.lines, s.err
+}
+
+// fetchRange pages through the lines logged between start and end with query_range and
+// delivers them to the sink. It returns the number of lines fetched.
+func fetchRange(ctx context.Context, opts LokiOptions, sink Sink, start, end time.Time) (int, error) {
+	total := 0
+	for start.Before(end) {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		streams, err := opts.Client.QueryRange(ctx, loki.QueryRangeParams{
+			Query: opts.Query,
+			Start: start,
+			End:   end,
+			Limit: rangePageSize,
+		}, opts.Tenant)
+		if err != nil {
+			return total, fmt.Errorf("failed to query flow %s: %w", opts.Name, err)
+		}
+
+		entries := sortEntries(streams)
+		for _, e := range entries {
+			sink.ProcessEntry(e)
+		}
+		total += len(entries)
+
+		if len(entries) < rangePageSize {
+			break
+		}
+
+		// continue from the last line, the sink skips lines that were already processed
+		next := entries[len(entries)-1].Timestamp
+		if !next.After(start) {
+			// a whole page of lines sharing one timestamp, there is no way to page through it
+			slog.Warn("Too many lines with the same timestamp, skipping the rest of them", "flow", opts.Name, "ts", next)
+			next = next.Add(time.Nanosecond)
+		}
+		start = next
+	}
+
+	return total, nil
+}
+
+// sortEntries merges the lines of all streams in timestamp order.
+func sortEntries(streams []loki.Stream) []Entry {
+	var entries []Entry
+	for _, stream := range streams {
+		for _, line := range stream.Values {
+			ts, err := parseTimestamp(line.Timestamp)
+			if err != nil {
+				slog.Error("Failed to parse timestamp", "error", err)
+				continue
+			}
+			entries = append(entries, Entry{
+				Timestamp: ts,
+				Line:      line.Line,
+				Labels:    stream.Details,
+				Metadata:  line.Metadata,
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries
+}
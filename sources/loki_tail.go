@@ -0,0 +1,226 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/coder/websocket"
+	"github.com/live-labs/lokiactor/backoff"
+	"github.com/live-labs/lokiactor/config"
+	"github.com/live-labs/lokiactor/loki"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LokiOptions are the settings shared by the Loki sources.
+type LokiOptions struct {
+	Name     string // used in logs, usually the flow name
+	Endpoint string // name of the loki endpoint
+	Client   *loki.Client
+	Tenant   string
+
+	Query       string
+	Limit       int
+	DelayForSec int
+	StartOffset time.Duration // how far back to start when nothing was read yet
+
+	Backoff      config.Backoff
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+}
+
+// LokiTail streams lines from the Loki websocket tail endpoint.
+type LokiTail struct {
+	opts  LokiOptions
+	state stateHolder
+}
+
+func NewLokiTail(opts LokiOptions) *LokiTail {
+	return &LokiTail{opts: opts}
+}
+
+func (s *LokiTail) State() State {
+	return s.state.get()
+}
+
+// Run streams lines from the tail endpoint, reconnecting until ctx is done.
+func (s *LokiTail) Run(ctx context.Context, sink Sink) {
+	defer s.state.set(s.opts.Name, StateStopped, nil)
+
+	retry := backoff.New(s.opts.Backoff)
+	delay := time.Duration(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		// resume from the last processed line; lines sharing its timestamp may not all have
+		// been delivered yet, so start at that timestamp and let the sink drop the duplicates
+		start := sink.ResumeFrom(time.Now().Add(-s.opts.StartOffset))
+		urlStr := s.opts.Client.TailURL(loki.TailParams{
+			Query:       s.opts.Query,
+			Start:       start,
+			Limit:       s.opts.Limit,
+			DelayForSec: s.opts.DelayForSec,
+		})
+
+		s.state.set(s.opts.Name, StateConnecting, nil)
+		slog.Info("Connecting to Loki stream", "flow", s.opts.Name, "endpoint", s.opts.Endpoint, "url", urlStr)
+		conn, response, err := s.opts.Client.Tail(ctx, urlStr, s.opts.Tenant)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+
+			if response != nil && response.StatusCode >= 400 && response.StatusCode < 500 {
+				// retrying quickly won't fix a bad query or bad credentials
+				delay = retry.Capped()
+				s.state.set(s.opts.Name, StateRejected, err)
+				slog.Error("Loki rejected the stream request, check the query and credentials",
+					"flow", s.opts.Name, "endpoint", s.opts.Endpoint, "status", response.StatusCode,
+					"body", readBody(response), "retry_in", delay, "error", err)
+				continue
+			}
+
+			delay = retry.Next()
+			s.state.set(s.opts.Name, StateBackoff, err)
+			slog.Error("Failed to connect to Loki stream", "flow", s.opts.Name, "endpoint", s.opts.Endpoint,
+				"retry_in", delay, "error", err)
+			continue
+		}
+
+		retry.Reset()
+		s.state.set(s.opts.Name, StateConnected, nil)
+		slog.Info("Connected to Loki stream", "flow", s.opts.Name, "endpoint", s.opts.Endpoint, "url", urlStr)
+
+		conn.SetReadLimit(-1)
+
+		err = s.processMessages(ctx, conn, sink)
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay = retry.Next()
+		s.state.set(s.opts.Name, StateBackoff, err)
+		slog.Info("Reconnecting to Loki stream", "flow", s.opts.Name, "endpoint", s.opts.Endpoint, "retry_in", delay)
+	}
+}
+
+// readBody returns the beginning of a failed response body for diagnostics.
+func readBody(response *http.Response) string {
+	if response.Body == nil {
+		return ""
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return strings.TrimSpace(string(body))
+}
+
+// keepAlive pings Loki until ctx is done and closes a connection that stopped answering,
+// which would otherwise block reading forever.
+func (s *LokiTail) keepAlive(ctx context.Context, conn *websocket.Conn) {
+	t := time.NewTicker(s.opts.PingInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, s.opts.PingTimeout)
+		err := conn.Ping(pingCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Loki stream did not answer ping, closing connection", "flow", s.opts.Name, "endpoint", s.opts.Endpoint, "error", err)
+			conn.CloseNow()
+			return
+		}
+	}
+}
+
+// processMessages reads the stream until the connection fails and returns the error.
+func (s *LokiTail) processMessages(ctx context.Context, conn *websocket.Conn, sink Sink) error {
+	defer conn.CloseNow()
+
+	pingCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.keepAlive(pingCtx, conn)
+
+	for {
+		websocketMessageType, websocketMessage, err := conn.Read(ctx)
+
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to read from websocket", "flow", s.opts.Name, "endpoint", s.opts.Endpoint, "error", err)
+			}
+			return err
+		}
+
+		if websocketMessageType != websocket.MessageText {
+			slog.Warn("Unexpected websocket message type", "type", websocketMessageType)
+			continue
+		}
+
+		var event loki.Event
+
+		err = json.Unmarshal(websocketMessage, &event)
+		if err != nil {
+			slog.Error("Failed to unmarshal websocket message", "error", err)
+			continue
+		}
+
+		processLokiEvent(event, sink)
+	}
+}
+
+// processLokiEvent converts a Loki event into entries for the sink.
+func processLokiEvent(event loki.Event, sink Sink) {
+	if len(event.DroppedEntries) > 0 {
+		dropped := make([]Dropped, 0, len(event.DroppedEntries))
+		for _, entry := range event.DroppedEntries {
+			ts, err := parseTimestamp(entry.Timestamp)
+			if err != nil {
+				slog.Error("Failed to parse dropped entry timestamp", "error", err)
+				continue
+			}
+			dropped = append(dropped, Dropped{Timestamp: ts, Labels: entry.Labels})
+		}
+		sink.ProcessDropped(dropped)
+	}
+
+	for _, stream := range event.Streams {
+		for _, line := range stream.Values {
+			ts, err := parseTimestamp(line.Timestamp)
+			if err != nil {
+				slog.Error("Failed to parse timestamp", "error", err)
+				continue
+			}
+			sink.ProcessEntry(Entry{
+				Timestamp: ts,
+				Line:      line.Line,
+				Labels:    stream.Details,
+				Metadata:  line.Metadata,
+			})
+		}
+	}
+}
+
+// parseTimestamp parses a nanosecond unix epoch.
+func parseTimestamp(ts string) (time.Time, error) {
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, n), nil
+}
@@ -0,0 +1,192 @@
+package sources
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SharedTails lets flows tailing the very same stream share one Loki connection.
+type SharedTails struct {
+	mu    sync.Mutex
+	tails map[tailKey]*sharedTail
+}
+
+// tailKey identifies the stream of a tail, flows with equal keys get the same lines.
+type tailKey struct {
+	endpoint    string
+	tenant      string
+	query       string
+	limit       int
+	delayForSec int
+	startOffset time.Duration
+}
+
+func NewSharedTails() *SharedTails {
+	return &SharedTails{
+		tails: make(map[tailKey]*sharedTail),
+	}
+}
+
+// Source returns the tail source of a flow. All flows must get their source before any
+// of them runs, the shared connection is opened once all flows sharing it are running.
+func (t *SharedTails) Source(opts LokiOptions) Source {
+	key := tailKey{
+		endpoint:    opts.Endpoint,
+		tenant:      opts.Tenant,
+		query:       opts.Query,
+		limit:       opts.Limit,
+		delayForSec: opts.DelayForSec,
+		startOffset: opts.StartOffset,
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.tails[key]
+	if !ok {
+		st = &sharedTail{
+			opts:  opts,
+			sinks: make(map[*tailSubscription]*tailSink),
+		}
+		t.tails[key] = st
+	}
+	st.names = append(st.names, opts.Name)
+
+	return &tailSubscription{tail: st}
+}
+
+// sharedTail runs a single LokiTail and fans its lines out to the sinks of all flows sharing it.
+type sharedTail struct {
+	opts  LokiOptions
+	names []string // flows sharing the tail
+
+	mu     sync.Mutex
+	tail   *LokiTail // nil until all flows are running
+	sinks  map[*tailSubscription]*tailSink
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// tailSink is a flow sink with the point it resumed from, the shared tail may resume further back
+// for another flow and lines older than that must not reach it.
+type tailSink struct {
+	sink  Sink
+	start time.Time
+}
+
+type tailSubscription struct {
+	tail *sharedTail
+}
+
+func (s *tailSubscription) State() State {
+	s.tail.mu.Lock()
+	defer s.tail.mu.Unlock()
+
+	if s.tail.tail == nil {
+		return State{State: StateConnecting}
+	}
+	return s.tail.tail.State()
+}
+
+func (s *tailSubscription) Run(ctx context.Context, sink Sink) {
+	s.tail.join(ctx, s, sink)
+	<-ctx.Done()
+	s.tail.leave(s)
+}
+
+// join adds the sink of a flow, starting the tail once all flows sharing it have joined.
+func (t *sharedTail) join(ctx context.Context, sub *tailSubscription, sink Sink) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sinks[sub] = &tailSink{sink: sink}
+	if len(t.sinks) < len(t.names) || t.tail != nil {
+		return
+	}
+
+	opts := t.opts
+	opts.Name = strings.Join(t.names, ",")
+	if len(t.names) > 1 {
+		slog.Info("Flows share one Loki stream", "flows", opts.Name, "endpoint", opts.Endpoint, "query", opts.Query)
+	}
+
+	tailCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	t.tail = NewLokiTail(opts)
+	t.cancel = cancel
+	t.done = make(chan struct{})
+
+	go func() {
+		t.tail.Run(tailCtx, t)
+		close(t.done)
+	}()
+}
+
+// leave removes the sink of a flow, stopping the tail when the last flow left.
+func (t *sharedTail) leave(sub *tailSubscription) {
+	t.mu.Lock()
+	delete(t.sinks, sub)
+	if len(t.sinks) > 0 || t.tail == nil {
+		t.mu.Unlock()
+		return
+	}
+	cancel, done := t.cancel, t.done
+	t.mu.Unlock()
+
+	cancel()
+	<-done
+
+	t.mu.Lock()
+	t.tail = nil
+	t.mu.Unlock()
+}
+
+// snapshot returns the current sinks, so they are called without holding the lock.
+func (t *sharedTail) snapshot() []*tailSink {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sinks := make([]*tailSink, 0, len(t.sinks))
+	for _, s := range t.sinks {
+		sinks = append(sinks, s)
+	}
+	return sinks
+}
+
+func (t *sharedTail) ProcessEntry(e Entry) {
+	for _, s := range t.snapshot() {
+		if e.Timestamp.Before(s.start) {
+			continue
+		}
+		s.sink.ProcessEntry(e)
+	}
+}
+
+func (t *sharedTail) ProcessDropped(d []Dropped) {
+	for _, s := range t.snapshot() {
+		s.sink.ProcessDropped(d)
+	}
+}
+
+// ResumeFrom returns the earliest point any of the flows resumes from.
+func (t *sharedTail) ResumeFrom(def time.Time) time.Time {
+	var from time.Time
+	for i, s := range t.snapshot() {
+		s.start = s.sink.ResumeFrom(def)
+		if i == 0 || s.start.Before(from) {
+			from = s.start
+		}
+	}
+	if from.IsZero() {
+		return def
+	}
+	return from
+}
+
+func (t *sharedTail) Settle(ts time.Time) {
+	for _, s := range t.snapshot() {
+		s.sink.Settle(ts)
+	}
+}
@@ -0,0 +1,40 @@
+package sources
+
+import (
+	"context"
+	"time"
+)
+
+// Entry is a log line produced by a source.
+type Entry struct {
+	Timestamp time.Time
+	Line      string
+	Labels    map[string]string
+	Metadata  map[string]string // structured metadata, may be nil
+}
+
+// Dropped is a log line the source knows it lost, e.g. because Loki dropped it from the tail.
+type Dropped struct {
+	Timestamp time.Time
+	Labels    map[string]string
+}
+
+// Sink consumes the lines of a source, usually a flow.
+type Sink interface {
+	// ProcessEntry handles a log line.
+	ProcessEntry(e Entry)
+	// ProcessDropped handles lines the source lost.
+	ProcessDropped(d []Dropped)
+	// ResumeFrom returns the time to resume reading from, def if nothing was read yet.
+	ResumeFrom(def time.Time) time.Time
+	// Settle tells the sink no line older than ts will be delivered anymore.
+	Settle(ts time.Time)
+}
+
+// Source produces log lines for a flow.
+type Source interface {
+	// Run delivers lines to the sink until ctx is done or the source is exhausted.
+	Run(ctx context.Context, sink Sink)
+	// State returns the connection health of the source.
+	State() State
+}
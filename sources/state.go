@@ -0,0 +1,57 @@
+package sources
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of the connection of a source.
+type ConnState string
+
+const (
+	StateConnecting ConnState = "connecting"
+	StateConnected  ConnState = "connected"
+	StateBackoff    ConnState = "backoff"  // waiting before reconnecting after a network or server error
+	StateRejected   ConnState = "rejected" // the request was rejected, usually a bad query or credentials
+	StateStopped    ConnState = "stopped"
+)
+
+// State describes the connection health of a source.
+type State struct {
+	State     ConnState
+	Since     time.Time
+	Attempts  int    // failed connection attempts since the last successful connection
+	LastError string // last connection error, if any
+	Dropped   int64  // lines dropped from the stream since start, counted by the flow
+}
+
+type stateHolder struct {
+	mu    sync.Mutex
+	state State
+}
+
+func (h *stateHolder) get() State {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// set changes the connection state, errors are counted as failed attempts.
+func (h *stateHolder) set(source string, state ConnState, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if state == StateConnected {
+		h.state.Attempts = 0
+	}
+	if err != nil {
+		h.state.Attempts++
+		h.state.LastError = err.Error()
+	}
+	if h.state.State != state {
+		slog.Debug("Source connection state changed", "source", source, "from", h.state.State, "to", state)
+		h.state.State = state
+		h.state.Since = time.Now()
+	}
+}
@@ -0,0 +1,68 @@
+package sources
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Stdin reads log lines from the standard input until it's closed, e.g. to run triggers
+// over captured logs in CI.
+type Stdin struct {
+	name   string // used in logs, usually the flow name
+	r      io.Reader
+	labels map[string]string
+	state  stateHolder
+}
+
+func NewStdin(name string, labels map[string]string) *Stdin {
+	return &Stdin{
+		name:   name,
+		r:      os.Stdin,
+		labels: labels,
+	}
+}
+
+func (s *Stdin) State() State {
+	return s.state.get()
+}
+
+func (s *Stdin) Run(ctx context.Context, sink Sink) {
+	defer s.state.set(s.name, StateStopped, nil)
+	s.state.set(s.name, StateConnected, nil)
+
+	lines := make(chan string)
+	errs := make(chan error, 1)
+
+	// reading blocks, so it happens in the background to be able to stop on ctx
+	go func() {
+		scanner := bufio.NewScanner(s.r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		errs <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case line := <-lines:
+			sink.ProcessEntry(newLineEntry(line, s.labels))
+		case err := <-errs:
+			if err != nil {
+				slog.Error("Failed to read standard input", "flow", s.name, "error", err)
+				return
+			}
+			slog.Info("Standard input closed", "flow", s.name)
+			return
+		}
+	}
+}
@@ -12,6 +12,8 @@ type Trigger struct {
 	Name        string
 	Regex       *regexp.Regexp
 	IgnoreRegex *regexp.Regexp
+	Severity    string
+	Color       string
 
 	Lines           int
 	Action          actions.Action
@@ -55,6 +57,8 @@ func New(ctx context.Context, cfg config.Trigger) (*Trigger, error) {
 		Name:            cfg.Name,
 		Regex:           re,
 		IgnoreRegex:     ignoreRe,
+		Severity:        cfg.Severity,
+		Color:           cfg.Color,
 		Lines:           cfg.Lines,
 		Action:          action,
 		NextLinesAction: nextLinesAction,